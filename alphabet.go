@@ -0,0 +1,100 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//Alphabet maps the 32 characters that messages are written in to the 5-bit integers that the machine works on,
+//and back again
+type Alphabet struct {
+	symbols []rune
+	codes   map[rune]int
+}
+
+//BLETCHLEY_ALPHABET is the notation used throughout this package: letters stand for themselves,
+//and 2, 3, 4, 5, 6 and 7 stand for null, line feed, space, carriage return, figures shift and letters shift
+//It is used wherever no other Alphabet is given
+var BLETCHLEY_ALPHABET = mustAlphabet("2T3O4HNM5LRGIPCVEZDBSYFXAWJ6UQK7")
+
+//TUNNY_ALPHABET is the notation of the General Report on Tunny, where /, 3, 9, 4, + and 8 stand for
+//null, line feed, space, carriage return, figures shift and letters shift
+//(the Report also writes 5 for figures shift and - for letters shift)
+var TUNNY_ALPHABET = mustAlphabet("/T3O9HNM4LRGIPCVEZDBSYFXAWJ+UQK8")
+
+//ITA2_ALPHABET writes the control characters with symbols for their names: ␀ (null), ␊ (line feed), ␠ (space),
+//␍ (carriage return), ↑ (figures shift) and ↓ (letters shift)
+var ITA2_ALPHABET = mustAlphabet("␀T␊O␠HNM␍LRGIPCVEZDBSYFXAWJ↑UQK↓")
+
+//NewAlphabet creates an Alphabet from a string of 32 different characters, the character for 0 first
+//Line breaks cannot be used, since they separate messages
+func NewAlphabet(symbols string) (*Alphabet, error) {
+	if utf8.RuneCountInString(symbols) != 32 {
+		return nil, fmt.Errorf("error: an alphabet needs 32 characters, got %d", utf8.RuneCountInString(symbols))
+	}
+	a := &Alphabet{symbols: make([]rune, 0, 32), codes: map[rune]int{}}
+	for _, symbol := range symbols {
+		if symbol == '\n' || symbol == '\r' {
+			return nil, errors.New("error: an alphabet cannot contain a line break")
+		}
+		if _, ok := a.codes[symbol]; ok {
+			return nil, fmt.Errorf("error: character %q appears twice in the alphabet", symbol)
+		}
+		a.codes[symbol] = len(a.symbols)
+		a.symbols = append(a.symbols, symbol)
+	}
+	return a, nil
+}
+
+//mustAlphabet is like NewAlphabet, but panics if the alphabet is invalid
+func mustAlphabet(symbols string) *Alphabet {
+	a, err := NewAlphabet(symbols)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+//orDefault returns the alphabet, or BLETCHLEY_ALPHABET if it is nil
+func (a *Alphabet) orDefault() *Alphabet {
+	if a == nil {
+		return BLETCHLEY_ALPHABET
+	}
+	return a
+}
+
+//Code returns the integer (0-31) that the character stands for, and false if it is not in the alphabet
+func (a *Alphabet) Code(symbol rune) (int, bool) {
+	code, ok := a.codes[symbol]
+	return code, ok
+}
+
+//Symbol returns the character for an integer, which must be 0-31
+func (a *Alphabet) Symbol(code int) rune {
+	return a.symbols[code]
+}
+
+//String returns the 32 characters of the alphabet, as passed to NewAlphabet
+func (a *Alphabet) String() string {
+	return string(a.symbols)
+}
+
+//Translate rewrites text written in this alphabet in another, character by character
+//Line breaks are passed through unchanged
+func (a *Alphabet) Translate(text string, to *Alphabet) (string, error) {
+	var result strings.Builder
+	for _, character := range text {
+		if character == '\n' || character == '\r' {
+			result.WriteRune(character)
+			continue
+		}
+		code, ok := a.Code(character)
+		if !ok {
+			return "", fmt.Errorf("error: character %q not in alphabet", character)
+		}
+		result.WriteRune(to.Symbol(code))
+	}
+	return result.String(), nil
+}
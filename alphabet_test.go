@@ -0,0 +1,110 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_Alphabet(t *testing.T) {
+
+	for code := 0; code < 32; code++ {
+		for _, a := range []*Alphabet{BLETCHLEY_ALPHABET, TUNNY_ALPHABET, ITA2_ALPHABET} {
+			if c, ok := a.Code(a.Symbol(code)); !ok || c != code {
+				t.Errorf("Alphabet %s maps %d to %q and back to %d", a, code, a.Symbol(code), c)
+			}
+		}
+	}
+	if c, ok := BLETCHLEY_ALPHABET.Code('E'); !ok || c != 16 {
+		t.Errorf("E is %d, expected 16", c)
+	}
+
+	translated, err := BLETCHLEY_ALPHABET.Translate("KING4HENRY4IV35\nUMUM", TUNNY_ALPHABET)
+	if err != nil {
+		t.Fatalf("Error translating: %s", err.Error())
+	}
+	if translated != "KING9HENRY9IV34\nUMUM" {
+		t.Errorf("Translated to %q", translated)
+	}
+	if shifts, _ := BLETCHLEY_ALPHABET.Translate("67", TUNNY_ALPHABET); shifts != "+8" {
+		t.Errorf("Shifts translated to %q, expected figures shift + and letters shift 8", shifts)
+	}
+	if _, err := TUNNY_ALPHABET.Translate("KING4HENRY4IV35", BLETCHLEY_ALPHABET); err == nil {
+		t.Errorf("Expected an error translating a character that is not in the alphabet")
+	}
+
+	for _, symbols := range []string{
+		"2T3O4HNM5LRGIPCVEZDBSYFXAWJ6UQK",
+		"2T3O4HNM5LRGIPCVEZDBSYFXAWJ6UQK77",
+		"2T3O4HNM5LRGIPCVEZDBSYFXAWJ6UQKT",
+		"2T3O4HNM5LRGIPCVEZDBSYFXAWJ6UQK\n",
+	} {
+		if _, err := NewAlphabet(symbols); err == nil {
+			t.Errorf("Expected alphabet %q to be invalid", symbols)
+		}
+	}
+}
+
+func Test_MachineAlphabet(t *testing.T) {
+
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35"
+	expected, err := m.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	m.Alphabet = ITA2_ALPHABET
+	m.Reset()
+	ita2Plaintext, _ := BLETCHLEY_ALPHABET.Translate(plaintext, ITA2_ALPHABET)
+	ciphertext, err := m.Encrypt(ita2Plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	if translated, _ := ITA2_ALPHABET.Translate(ciphertext, BLETCHLEY_ALPHABET); translated != expected {
+		t.Errorf("Encrypted to %q, expected %q", translated, expected)
+	}
+	m.Reset()
+	if decrypted, err := m.Decrypt(ciphertext); err != nil || decrypted != ita2Plaintext {
+		t.Errorf("Decrypted to %q, expected %q", decrypted, ita2Plaintext)
+	}
+	m.Reset()
+	if _, err := m.Encrypt(plaintext); err == nil {
+		t.Errorf("Expected an error encrypting a character that is not in the alphabet")
+	}
+	m.Reset()
+}
+
+func Test_CrackAlphabet(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	ciphertext, err := BLETCHLEY_ALPHABET.Translate(string(bts), ITA2_ALPHABET)
+	if err != nil {
+		t.Fatalf("Error translating: %s", err.Error())
+	}
+
+	//The default cribs are rewritten in the alphabet of the messages
+	result, err := Crack(strings.NewReader(ciphertext), CrackOptions{Alphabet: ITA2_ALPHABET})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	for i, wheel := range result.Wheels {
+		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+			t.Errorf("Wheel %d does not match expected result", i)
+		}
+	}
+
+	if _, err := Crack(strings.NewReader(string(bts)), CrackOptions{Alphabet: ITA2_ALPHABET}); err == nil {
+		t.Errorf("Expected an error cracking messages in another alphabet")
+	}
+	if _, err := Crack(strings.NewReader(ciphertext), CrackOptions{Alphabet: ITA2_ALPHABET, Cribs: []Crib{{Text: "UMUM4", Offset: 0}}}); err == nil {
+		t.Errorf("Expected an error for a crib in another alphabet")
+	}
+}
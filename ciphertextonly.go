@@ -0,0 +1,351 @@
+package geheimschreiber
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"strings"
+)
+
+//NgramModel scores text by how often its n-grams (runs of N characters) appear in the language
+type NgramModel struct {
+	N int
+
+	//logProbs holds the log probability of every n-gram, indexed by the integer representations
+	//of its characters, most significant first
+	logProbs []float64
+}
+
+//TrainNgramModel counts the n-grams in a sample of plaintext, written in BLETCHLEY_ALPHABET (see Alphabet.Translate)
+//(so spaces are written as "4", as in "KING4HENRY4IV")
+//Line breaks are ignored, and n-grams do not span them
+func TrainNgramModel(r io.Reader, n int) (*NgramModel, error) {
+	if n < 1 || n > 4 {
+		return nil, errors.New("error: n-gram size must be between 1 and 4")
+	}
+
+	m := &NgramModel{N: n, logProbs: make([]float64, 1<<uint(5*n))}
+	total := 0.0
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		ints := make([]int, len(line))
+		for i, character := range line {
+			c, ok := BLETCHLEY_ALPHABET.Code(character)
+			if !ok {
+				return nil, &MalformedLineError{Line: lineNumber, Reason: fmt.Sprintf("character %q not in alphabet", character)}
+			}
+			ints[i] = c
+		}
+		for i := 0; i+n <= len(ints); i++ {
+			m.logProbs[ngramIndex(ints[i:i+n])]++
+			total++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, errors.New("error: no n-grams in sample")
+	}
+
+	//Smooth the counts, so that n-grams we have never seen are unlikely rather than impossible
+	const smoothing = 0.01
+	for i, count := range m.logProbs {
+		m.logProbs[i] = math.Log((count + smoothing) / (total + smoothing*float64(len(m.logProbs))))
+	}
+	return m, nil
+}
+
+//ngramIndex returns the index of the n-gram made up of the given characters
+func ngramIndex(ints []int) int {
+	index := 0
+	for _, c := range ints {
+		index = index<<5 | c
+	}
+	return index
+}
+
+//Score returns the log probability of the text under the model
+//Higher scores are more like the sample the model was trained on
+//Line breaks are ignored, and characters that are not in BLETCHLEY_ALPHABET are skipped
+func (m *NgramModel) Score(text string) float64 {
+	score := 0.0
+	for _, line := range strings.Split(text, "\n") {
+		ints := []int{}
+		for _, character := range line {
+			if c, ok := BLETCHLEY_ALPHABET.Code(character); ok {
+				ints = append(ints, c)
+			}
+		}
+		for i := 0; i+m.N <= len(ints); i++ {
+			score += m.logProbs[ngramIndex(ints[i:i+m.N])]
+		}
+	}
+	return score
+}
+
+//characterLogProbs returns the log probability of each single character under the model
+func (m *NgramModel) characterLogProbs() []float64 {
+	probs := make([]float64, 32)
+	for index, logProb := range m.logProbs {
+		probs[index>>uint(5*(m.N-1))] += math.Exp(logProb)
+	}
+	for c, prob := range probs {
+		probs[c] = math.Log(prob)
+	}
+	return probs
+}
+
+//CiphertextOnlyOptions configures CrackCiphertextOnly
+type CiphertextOnlyOptions struct {
+	//WheelSizes are the sizes of the ten wheels, in the order they sit on the machine
+	//Unlike CrackOptions.WheelSizes, this is not an inventory to choose from: the wheel order must already be known,
+	//and the result's WheelOrder is simply 0-9
+	//If nil, WHEEL_SIZES is used in order
+	WheelSizes []int
+
+	//Model is used to score candidate decryptions; it is required
+	Model *NgramModel
+
+	//Restarts is the number of times to climb from a new random set of wheels
+	//The best result is returned; if zero, a single climb is made
+	Restarts int
+
+	//MaxSweeps limits the number of passes over every spoke in a single climb
+	//If zero, the climb continues until no single spoke can be changed to improve the score
+	MaxSweeps int
+
+	//Rand is the source of the random starting wheels
+	//If nil, a source seeded with 1 is used, so results are reproducible
+	Rand *rand.Rand
+
+	//Alphabet is the notation that the messages are written in
+	//If nil, BLETCHLEY_ALPHABET is used
+	Alphabet *Alphabet
+
+	//Network is the permutation network of the machine that sent the traffic
+	//If nil, DEFAULT_NETWORK is used
+	Network PermutationNetwork
+}
+
+//CrackCiphertextOnly attempts to recover the wheels from intercepted messages (one per line)
+//without any known plaintext, so it works even if the preamble has been stripped or varied
+//It starts from random wheels and repeatedly changes single spokes whenever doing so makes
+//the decryption score better under opts.Model (hill-climbing), so it needs a large amount of traffic
+//and a model trained on plaintext that resembles the messages
+//The transpose wheels never change how many bits of a character are set, so the XOR wheels (0-4) are
+//climbed first, on their own, by how likely the number of 1s in each character of the ciphertext is;
+//then the transpose wheels (5-9), by how likely each decrypted character is; and finally all ten
+//wheels together, by the n-grams of the decryption
+//There is no guarantee that the result is correct; decrypt with it and check
+func CrackCiphertextOnly(r io.Reader, opts CiphertextOnlyOptions) (*CrackResult, error) {
+	if opts.Model == nil {
+		return nil, errors.New("error: a language model is required for a ciphertext-only attack")
+	}
+
+	wheelSizes := opts.WheelSizes
+	if wheelSizes == nil {
+		wheelSizes = WHEEL_SIZES
+	}
+	if len(wheelSizes) != 10 {
+		return nil, errors.New("error: expected ten wheel sizes")
+	}
+
+	rng := opts.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(1))
+	}
+
+	//We know none of the plaintext, so there are no cribs
+	ciphertext, _, err := parseIntercepts(r, []Crib{}, opts.Alphabet.orDefault())
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < opts.Model.N {
+		return nil, &InsufficientTrafficError{Wheel: 0, Spoke: -1}
+	}
+	cipherInts := make([]int, len(ciphertext))
+	for i := range ciphertext {
+		cipherInts[i], _ = BLETCHLEY_ALPHABET.Code(rune(ciphertext[i]))
+	}
+
+	characterLogProbs := opts.Model.characterLogProbs()
+	network := opts.Network.orDefault()
+
+	var best [][]int
+	bestScore := math.Inf(-1)
+	for restart := 0; restart == 0 || restart < opts.Restarts; restart++ {
+		items := make([][]int, len(wheelSizes))
+		for i, size := range wheelSizes {
+			items[i] = make([]int, size)
+			for j := range items[i] {
+				items[i][j] = rng.Intn(2)
+			}
+		}
+
+		climbXORWheels(items, cipherInts, characterLogProbs, opts.MaxSweeps)
+		climbTransposeWheels(items, cipherInts, network, characterLogProbs, opts.MaxSweeps)
+		score := hillClimb(items, cipherInts, network, opts.Model, opts.MaxSweeps)
+		if score > bestScore {
+			best = items
+			bestScore = score
+		}
+	}
+
+	wheels := make([]*Wheel, len(best))
+	order := make([]int, len(best))
+	for i, items := range best {
+		wheels[i] = NewWheel(items)
+		order[i] = i
+	}
+	return &CrackResult{Wheels: wheels, WheelOrder: order}, nil
+}
+
+//climbXORWheels changes single spokes of the XOR wheels (in place) for as long as that makes the number of 1s
+//in each character of the ciphertext more likely, given the character probabilities of the plaintext
+//That number is the same before and after the transpose wheels, so they can be ignored
+func climbXORWheels(items [][]int, cipherInts []int, characterLogProbs []float64, maxSweeps int) {
+
+	//weightLogProbs[mask][ones] is the log probability that a plaintext character, XORed with mask, has that many 1s
+	var weightLogProbs [32][6]float64
+	for mask := range weightLogProbs {
+		var probs [6]float64
+		for p, logProb := range characterLogProbs {
+			probs[bits.OnesCount(uint(p^mask))] += math.Exp(logProb)
+		}
+		for ones, prob := range probs {
+			weightLogProbs[mask][ones] = math.Log(prob)
+		}
+	}
+
+	climbSpokes(items, []int{0, 1, 2, 3, 4}, len(cipherInts), maxSweeps, func(position int) float64 {
+		mask := 0
+		for i := 0; i < 5; i++ {
+			mask |= items[i][position%len(items[i])] << uint(4-i)
+		}
+		return weightLogProbs[mask][bits.OnesCount(uint(cipherInts[position]))]
+	})
+}
+
+//climbTransposeWheels changes single spokes of the transpose wheels (in place) for as long as that makes each
+//decrypted character more likely, given the character probabilities of the plaintext
+func climbTransposeWheels(items [][]int, cipherInts []int, network PermutationNetwork, characterLogProbs []float64, maxSweeps int) {
+	climbSpokes(items, []int{5, 6, 7, 8, 9}, len(cipherInts), maxSweeps, func(position int) float64 {
+		var bits [10]int
+		for i := range bits {
+			bits[i] = items[i][position%len(items[i])]
+		}
+		return characterLogProbs[network.decryptWithBits(cipherInts[position], bits)]
+	})
+}
+
+//climbSpokes changes single spokes of the given wheels (in place) for as long as that improves the total score
+//of the positions that read them; score gives the score of a single position of the message stream, using the
+//wheels as they are
+func climbSpokes(items [][]int, wheels []int, length int, maxSweeps int, score func(position int) float64) {
+	spokeScore := func(i, spoke int) float64 {
+		total := 0.0
+		for position := spoke; position < length; position += len(items[i]) {
+			total += score(position)
+		}
+		return total
+	}
+
+	for sweep := 0; maxSweeps == 0 || sweep < maxSweeps; sweep++ {
+		improved := false
+		for _, i := range wheels {
+			for spoke := range items[i] {
+				before := spokeScore(i, spoke)
+				items[i][spoke] ^= 1
+				if spokeScore(i, spoke) > before {
+					improved = true
+					continue
+				}
+
+				//Put it back
+				items[i][spoke] ^= 1
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+}
+
+//hillClimb changes single spokes of the wheels (in place) for as long as that improves the score
+//of the decryption through the network, and returns the final score
+func hillClimb(items [][]int, cipherInts []int, network PermutationNetwork, model *NgramModel, maxSweeps int) float64 {
+	n := model.N
+
+	decryptAt := func(position int) int {
+		var bits [10]int
+		for i := range bits {
+			bits[i] = items[i][position%len(items[i])]
+		}
+		return network.decryptWithBits(cipherInts[position], bits)
+	}
+
+	plainInts := make([]int, len(cipherInts))
+	for position := range plainInts {
+		plainInts[position] = decryptAt(position)
+	}
+
+	//scoreAround scores every n-gram that includes one of the positions read from the given spoke
+	//N-grams that start at one of those positions are weighted most heavily; weighting every n-gram
+	//equally makes the climb get stuck far more often
+	scoreAround := func(spoke int, size int) float64 {
+		score := 0.0
+		for position := spoke; position < len(plainInts); position += size {
+			for start := position - n + 1; start <= position; start++ {
+				if start >= 0 && start+n <= len(plainInts) {
+					score += float64(start-position+n) * model.logProbs[ngramIndex(plainInts[start:start+n])]
+				}
+			}
+		}
+		return score
+	}
+
+	for sweep := 0; maxSweeps == 0 || sweep < maxSweeps; sweep++ {
+		improved := false
+		for i := range items {
+			size := len(items[i])
+			for spoke := 0; spoke < size; spoke++ {
+				before := scoreAround(spoke, size)
+
+				items[i][spoke] ^= 1
+				for position := spoke; position < len(plainInts); position += size {
+					plainInts[position] = decryptAt(position)
+				}
+
+				if scoreAround(spoke, size) > before {
+					improved = true
+					continue
+				}
+
+				//Put it back
+				items[i][spoke] ^= 1
+				for position := spoke; position < len(plainInts); position += size {
+					plainInts[position] = decryptAt(position)
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	score := 0.0
+	for start := 0; start+n <= len(plainInts); start++ {
+		score += model.logProbs[ngramIndex(plainInts[start:start+n])]
+	}
+	return score
+}
@@ -0,0 +1,68 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_CrackCiphertextOnly(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+
+	//Strip the preamble and sign-off from every message, so that none of the plaintext is known
+	bodies := []string{}
+	for _, line := range strings.Split(string(bts), "\n") {
+		line = strings.TrimRight(line, "\r")
+		body := strings.TrimSuffix(strings.TrimPrefix(line, "UMUM4VEVE35"), "35")
+		if body != "" && body != line {
+			bodies = append(bodies, body)
+		}
+	}
+
+	//Encrypt the first half of the play, and train on the second half, so the model has never seen the messages
+	model, err := TrainNgramModel(strings.NewReader(strings.Join(bodies[len(bodies)/2:], "\n")), 3)
+	if err != nil {
+		t.Fatalf("Error training model: %s", err.Error())
+	}
+	if model.Score("KING4HENRY4IV") <= model.Score("QXZQ7JQXK2VVW") {
+		t.Errorf("Model scores gibberish above English")
+	}
+
+	//The attack must decipher through whichever network sent the traffic
+	for _, network := range []PermutationNetwork{DEFAULT_NETWORK, {{1, 3}, {0, 2}, {2, 4}, {0, 1}, {3, 4}}} {
+		m, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, network)
+		if err != nil {
+			t.Fatalf("Error creating machine: %s", err.Error())
+		}
+		m.Reset()
+		ciphertext, err := m.Encrypt(strings.Join(bodies[:len(bodies)/2], "\n"))
+		m.Reset()
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+
+		result, err := CrackCiphertextOnly(strings.NewReader(ciphertext), CiphertextOnlyOptions{Model: model, Network: network})
+		if err != nil {
+			t.Fatalf("Error cracking ciphertext: %s", err.Error())
+		}
+		for i, wheel := range result.Wheels {
+			if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+				t.Errorf("Network %v: wheel %d does not match expected result", network, i)
+			}
+			if result.WheelOrder[i] != i {
+				t.Errorf("Position %d holds wheel %d, expected the wheels in the order given", i, result.WheelOrder[i])
+			}
+		}
+	}
+}
+
+func Test_CrackCiphertextOnlyRequiresModel(t *testing.T) {
+	_, err := CrackCiphertextOnly(strings.NewReader("BTEVUIO7WGRIDBEFFHSK6SOW6T"), CiphertextOnlyOptions{})
+	if err == nil {
+		t.Errorf("Expected an error without a language model")
+	}
+}
@@ -0,0 +1,285 @@
+//Command geheimschreiber encrypts, decrypts and cracks Geheimschreiber traffic from the command line
+//
+//	geheimschreiber keygen [-variant T52a/b] [-seed N] [-historical] [-format sheet|json] > key.txt
+//	geheimschreiber encrypt -key key.txt [-alphabet bletchley|tunny|ita2] < plaintext.txt > ciphertext.txt
+//	geheimschreiber decrypt -key key.txt [-alphabet bletchley|tunny|ita2] < ciphertext.txt > plaintext.txt
+//	geheimschreiber crack [-variant T52a/b] [-alphabet bletchley|tunny|ita2] [-format sheet|json] < intercepts.txt > key.txt
+//	geheimschreiber inspect [-key key.txt] < key.txt
+//
+//Messages are read from standard input, one per line, and written to standard output
+//Key files may be pin sheets or JSON; the format is worked out from the file when it is read
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChimeraCoder/geheimschreiber"
+)
+
+//ALPHABETS are the notations that messages can be written in, by the name given to -alphabet
+var ALPHABETS = map[string]*geheimschreiber.Alphabet{
+	"bletchley": geheimschreiber.BLETCHLEY_ALPHABET,
+	"tunny":     geheimschreiber.TUNNY_ALPHABET,
+	"ita2":      geheimschreiber.ITA2_ALPHABET,
+}
+
+//COMMANDS are the subcommands, by name
+var COMMANDS = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+	"encrypt": encrypt,
+	"decrypt": decrypt,
+	"crack":   crack,
+	"keygen":  keygen,
+	"inspect": inspect,
+}
+
+const usage = "usage: geheimschreiber encrypt|decrypt|crack|keygen|inspect [flags]"
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+//run runs the subcommand named by the first argument
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	command, ok := COMMANDS[args[0]]
+	if !ok {
+		return fmt.Errorf("error: unknown command %q\n%s", args[0], usage)
+	}
+	return command(args[1:], stdin, stdout)
+}
+
+//encrypt encrypts standard input with the key, line by line, continuing from one line to the next
+func encrypt(args []string, stdin io.Reader, stdout io.Writer) error {
+	m, err := machineFromFlags("encrypt", args)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(stdout)
+	w := geheimschreiber.NewEncryptWriter(out, m)
+	if _, err := io.Copy(w, stdin); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+//decrypt decrypts standard input with the key, line by line, continuing from one line to the next
+func decrypt(args []string, stdin io.Reader, stdout io.Writer) error {
+	m, err := machineFromFlags("decrypt", args)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(stdout)
+	if _, err := io.Copy(out, geheimschreiber.NewDecryptReader(stdin, m)); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+//machineFromFlags parses the -key and -alphabet flags shared by encrypt and decrypt, and sets up the machine
+func machineFromFlags(name string, args []string) (*geheimschreiber.Machine, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	keyFile := flags.String("key", "", "key file (pin sheet or JSON)")
+	alphabetName := flags.String("alphabet", "bletchley", "notation of the messages: bletchley, tunny or ita2")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *keyFile == "" {
+		return nil, fmt.Errorf("error: %s needs a key file (-key)", name)
+	}
+	alphabet, err := alphabetByName(*alphabetName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(*keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	key, err := readKey(f)
+	if err != nil {
+		return nil, err
+	}
+	m, err := key.Machine()
+	if err != nil {
+		return nil, err
+	}
+	m.Alphabet = alphabet
+	return m, nil
+}
+
+//crack recovers the key from the intercepts on standard input, which must begin and end with the
+//usual preamble and sign-off, and writes it to standard output
+func crack(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("crack", flag.ContinueOnError)
+	variantName := flags.String("variant", geheimschreiber.T52AB.Name, "model of machine that sent the traffic")
+	alphabetName := flags.String("alphabet", "bletchley", "notation of the intercepts: bletchley, tunny or ita2")
+	format := flags.String("format", "sheet", "format of the key: sheet or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	v, err := geheimschreiber.VariantByName(*variantName)
+	if err != nil {
+		return err
+	}
+	if v.Controls != nil {
+		return fmt.Errorf("error: the %s combines wheels into each control, which the cracker cannot handle", v.Name)
+	}
+	alphabet, err := alphabetByName(*alphabetName)
+	if err != nil {
+		return err
+	}
+
+	result, err := geheimschreiber.Crack(stdin, geheimschreiber.CrackOptions{
+		WheelSizes: v.WheelSizes,
+		Network:    v.Network,
+		Stepper:    v.Stepper,
+		Alphabet:   alphabet,
+	})
+	if err != nil {
+		return err
+	}
+	return writeKey(stdout, &geheimschreiber.Key{Variant: v, Wheels: result.Wheels, WheelOrder: result.WheelOrder}, *format)
+}
+
+//keygen writes a new key, with the wheels fitted in a random order and random pins, to standard output
+func keygen(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	variantName := flags.String("variant", geheimschreiber.T52AB.Name, "model of machine")
+	seed := flags.Int64("seed", 0, "seed for the random key; if 0, the current time is used")
+	historical := flags.Bool("historical", false, "keep each wheel roughly balanced and free of long runs")
+	format := flags.String("format", "sheet", "format of the key: sheet or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	v, err := geheimschreiber.VariantByName(*variantName)
+	if err != nil {
+		return err
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rules := geheimschreiber.PinRules{}
+	if *historical {
+		rules = geheimschreiber.HISTORICAL_PIN_RULES
+	}
+
+	key, err := geheimschreiber.GenerateKeyWithRules(rand.New(rand.NewSource(*seed)), v, rules)
+	if err != nil {
+		return err
+	}
+	return writeKey(stdout, key, *format)
+}
+
+//inspect reads a key, from -key or standard input, and describes each of its wheels
+func inspect(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "key file (pin sheet or JSON); if not given, the key is read from standard input")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	r := stdin
+	if *keyFile != "" {
+		f, err := os.Open(*keyFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	key, err := readKey(r)
+	if err != nil {
+		return err
+	}
+
+	variant := geheimschreiber.T52AB
+	if key.Variant != nil {
+		variant = key.Variant
+	}
+	out := bufio.NewWriter(stdout)
+	fmt.Fprintf(out, "variant  %s\n", variant.Name)
+	fmt.Fprintf(out, "wheel  size  start  ones  longest run\n")
+	for i, w := range key.Wheels {
+		ones, run := 0, geheimschreiber.LongestRun(w.Items)
+		for _, item := range w.Items {
+			ones += item
+		}
+		fmt.Fprintf(out, "%5d  %4d  %5d  %4d  %11d\n", i, w.MaxSize, w.CurrentIndex, ones, run)
+	}
+	if key.WheelOrder != nil {
+		fmt.Fprintf(out, "order  %s\n", strings.Trim(fmt.Sprint(key.WheelOrder), "[]"))
+	}
+	return out.Flush()
+}
+
+//readKey reads a key written as JSON or as a pin sheet
+func readKey(r io.Reader) (*geheimschreiber.Key, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, errors.New("error: the key file is empty")
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		br.ReadByte()
+	}
+
+	if b, _ := br.Peek(1); b[0] == '{' {
+		var key geheimschreiber.Key
+		if err := json.NewDecoder(br).Decode(&key); err != nil {
+			return nil, err
+		}
+		return &key, nil
+	}
+	return geheimschreiber.ReadPinSheet(br)
+}
+
+//writeKey writes the key in the given format, sheet or json
+func writeKey(w io.Writer, key *geheimschreiber.Key, format string) error {
+	switch format {
+	case "sheet":
+		return geheimschreiber.WritePinSheet(w, key)
+	case "json":
+		data, err := json.MarshalIndent(key, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	return fmt.Errorf("error: unknown key format %q, expected sheet or json", format)
+}
+
+//alphabetByName returns one of ALPHABETS
+func alphabetByName(name string) (*geheimschreiber.Alphabet, error) {
+	alphabet, ok := ALPHABETS[name]
+	if !ok {
+		names := []string{}
+		for n := range ALPHABETS {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("error: unknown alphabet %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return alphabet, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ChimeraCoder/geheimschreiber"
+)
+
+const TEST_CIPHERTEXT_FILE = "../../test_ciphertext.txt"
+const TEST_PLAINTEXT_FILE = "../../test_plaintext.txt"
+
+//runCommand runs the command with the given standard input, and returns its standard output
+func runCommand(t *testing.T, stdin string, args ...string) string {
+	var stdout bytes.Buffer
+	if err := run(args, strings.NewReader(stdin), &stdout); err != nil {
+		t.Fatalf("Error running %s: %s", strings.Join(args, " "), err.Error())
+	}
+	return stdout.String()
+}
+
+//writeKeyFile saves the key in a temporary file, and returns its name
+func writeKeyFile(t *testing.T, key string) string {
+	dir, err := ioutil.TempDir("", "geheimschreiber")
+	if err != nil {
+		t.Fatalf("Error creating directory: %s", err.Error())
+	}
+	filename := filepath.Join(dir, "key.txt")
+	if err := ioutil.WriteFile(filename, []byte(key), 0600); err != nil {
+		t.Fatalf("Error writing key: %s", err.Error())
+	}
+	return filename
+}
+
+func Test_KeygenEncryptDecrypt(t *testing.T) {
+
+	for _, format := range []string{"sheet", "json"} {
+		key := runCommand(t, "", "keygen", "-variant", "T52d", "-seed", "3", "-historical", "-format", format)
+		if key != runCommand(t, "", "keygen", "-variant", "T52d", "-seed", "3", "-historical", "-format", format) {
+			t.Errorf("Keys generated from the same seed differ")
+		}
+		keyFile := writeKeyFile(t, key)
+		defer os.RemoveAll(filepath.Dir(keyFile))
+
+		plaintext := "UMUM4VEVE35KING4HENRY4IV35\nUMUM4VEVE35FALSTAFF35\n"
+		ciphertext := runCommand(t, plaintext, "encrypt", "-key", keyFile)
+		if ciphertext == plaintext || strings.Count(ciphertext, "\n") != 2 {
+			t.Errorf("Unexpected ciphertext %q", ciphertext)
+		}
+		if decrypted := runCommand(t, ciphertext, "decrypt", "-key", keyFile); decrypted != plaintext {
+			t.Errorf("Decrypted %q, expected %q", decrypted, plaintext)
+		}
+
+		tunnyPlaintext, _ := geheimschreiber.BLETCHLEY_ALPHABET.Translate(plaintext, geheimschreiber.TUNNY_ALPHABET)
+		tunny := runCommand(t, tunnyPlaintext, "encrypt", "-key", keyFile, "-alphabet", "tunny")
+		if decrypted := runCommand(t, tunny, "decrypt", "-key", keyFile, "-alphabet", "tunny"); decrypted != tunnyPlaintext {
+			t.Errorf("Decrypted %q in the Tunny alphabet", decrypted)
+		}
+
+		if description := runCommand(t, key, "inspect"); !strings.HasPrefix(description, "variant  T52d\n") || strings.Count(description, "\n") != 13 {
+			t.Errorf("Unexpected description of the key:\n%s", description)
+		}
+	}
+}
+
+func Test_Crack(t *testing.T) {
+
+	ciphertext, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintext, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+
+	keyFile := writeKeyFile(t, runCommand(t, string(ciphertext), "crack"))
+	defer os.RemoveAll(filepath.Dir(keyFile))
+	if decrypted := runCommand(t, string(ciphertext), "decrypt", "-key", keyFile); decrypted != string(plaintext) {
+		t.Errorf("Cracked key does not decrypt the intercepts")
+	}
+}
+
+func Test_CommandErrors(t *testing.T) {
+
+	keyFile := writeKeyFile(t, "variant T52a/b\n")
+	defer os.RemoveAll(filepath.Dir(keyFile))
+
+	for _, args := range [][]string{
+		{},
+		{"translate"},
+		{"encrypt"},
+		{"encrypt", "-key", keyFile},
+		{"decrypt", "-key", keyFile + ".missing"},
+		{"keygen", "-variant", "T52z"},
+		{"keygen", "-format", "xml"},
+		{"crack", "-variant", "T52c"},
+		{"crack", "-alphabet", "morse"},
+		{"inspect"},
+	} {
+		var stdout bytes.Buffer
+		if err := run(args, strings.NewReader(""), &stdout); err == nil {
+			t.Errorf("Expected an error running %q", args)
+		}
+	}
+}
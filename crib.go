@@ -0,0 +1,164 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+//Crib is a piece of plaintext that is known to appear at a particular place in the messages
+type Crib struct {
+	Text string
+
+	//Offset is the position of the first character of Text within the message
+	//A negative offset counts back from the end of the message, in characters, so a suffix has an Offset of
+	//minus the number of characters in Text (which is not len(Text) if the alphabet has multibyte characters)
+	Offset int
+
+	//Message is the number of the message (counting from 1) that the crib applies to,
+	//or 0 if the crib applies to every message
+	Message int
+}
+
+//DEFAULT_CRIBS describes the framing used by every message we have intercepted so far:
+//they begin with "UMUM4VEVE35" and end with "35"
+var DEFAULT_CRIBS = []Crib{
+	Crib{Text: "UMUM4VEVE35", Offset: 0},
+	Crib{Text: "35", Offset: -2},
+}
+
+//defaultCribs returns DEFAULT_CRIBS, rewritten from BLETCHLEY_ALPHABET in the given alphabet
+func defaultCribs(alphabet *Alphabet) []Crib {
+	cribs := make([]Crib, len(DEFAULT_CRIBS))
+	for i, crib := range DEFAULT_CRIBS {
+		crib.Text, _ = BLETCHLEY_ALPHABET.Translate(crib.Text, alphabet)
+		cribs[i] = crib
+	}
+	return cribs
+}
+
+//applyCribs returns the plaintext that the cribs (written in the given alphabet) tell us for a message of the
+//given length, in BLETCHLEY_ALPHABET, with unknown positions marked with "-"
+//It returns a MalformedLineError if a crib does not fit in the message, or if two cribs disagree
+func applyCribs(cribs []Crib, length int, messageNumber int, lineNumber int, alphabet *Alphabet) (string, error) {
+	plaintext := []byte(strings.Repeat("-", length))
+
+	for _, crib := range cribs {
+		if crib.Message != 0 && crib.Message != messageNumber {
+			continue
+		}
+		if err := applyCrib(plaintext, crib, lineNumber, alphabet); err != nil {
+			return "", err
+		}
+	}
+	return string(plaintext), nil
+}
+
+//applyCrib writes the text of the crib, rewritten from the given alphabet in BLETCHLEY_ALPHABET, into the plaintext of a single message
+func applyCrib(plaintext []byte, crib Crib, lineNumber int, alphabet *Alphabet) error {
+	var text strings.Builder
+	for _, character := range crib.Text {
+		c, ok := alphabet.Code(character)
+		if !ok {
+			return fmt.Errorf("error: crib %q contains character %q, which is not in alphabet", crib.Text, character)
+		}
+		text.WriteRune(BLETCHLEY_ALPHABET.Symbol(c))
+	}
+	known := text.String()
+
+	offset := crib.Offset
+	if offset < 0 {
+		offset += len(plaintext)
+	}
+	if offset < 0 || offset+len(known) > len(plaintext) {
+		return &MalformedLineError{Line: lineNumber, Reason: fmt.Sprintf("message is too short for crib %q", crib.Text)}
+	}
+
+	for i := 0; i < len(known); i++ {
+		if plaintext[offset+i] != '-' && plaintext[offset+i] != known[i] {
+			return &MalformedLineError{Line: lineNumber, Reason: fmt.Sprintf("crib %q disagrees with another crib at position %d", crib.Text, offset+i)}
+		}
+		plaintext[offset+i] = known[i]
+	}
+	return nil
+}
+
+//CribPlacement is a place where a probable word might appear in the messages
+type CribPlacement struct {
+	//Crib places the word at its Offset within the given Message
+	//It can be added to CrackOptions.Cribs, or passed to IncrementalCracker.AddCrib, once the placement has been accepted
+	Crib
+
+	//Score is the number of bits of evidence for the placement
+	//A character that could have decrypted to any of n characters, given the known spokes, contributes log2(32/n)
+	Score float64
+}
+
+//DragCrib slides a probable word (such as "4ANGRIFF4") across every position of every message,
+//and returns the placements that do not contradict what is already known about the wheels,
+//with the most strongly supported placements first
+//The messages must be in the order in which they were sent, starting from position 0 of the wheels
+//Blank lines are skipped, and messages are numbered as Crack numbers them, so that the placements can be
+//passed straight back to the cracker
+//The word and the messages are written in opts.Alphabet, and were sent through opts.Network;
+//the other options are ignored
+func DragCrib(ciphertexts []string, wheels PartialWheels, word string, opts CrackOptions) ([]CribPlacement, error) {
+	if len(wheels) != 10 {
+		return nil, errors.New("error: expected ten wheels")
+	}
+	network := opts.Network.orDefault()
+	alphabet := opts.Alphabet.orDefault()
+
+	plainInts := []int{}
+	for _, character := range word {
+		c, ok := alphabet.Code(character)
+		if !ok {
+			return nil, fmt.Errorf("error: crib %q contains character %q, which is not in alphabet", word, character)
+		}
+		plainInts = append(plainInts, c)
+	}
+
+	placements := []CribPlacement{}
+	start := 0
+	messageNumber := 0
+	for lineIndex, ciphertext := range ciphertexts {
+		ciphertext = strings.TrimRight(ciphertext, "\r\n")
+		if ciphertext == "" {
+			continue
+		}
+		messageNumber++
+
+		cipherInts := []int{}
+		for _, character := range ciphertext {
+			c, ok := alphabet.Code(character)
+			if !ok {
+				return nil, &MalformedLineError{Line: lineIndex + 1, Reason: fmt.Sprintf("character %q not in alphabet", character)}
+			}
+			cipherInts = append(cipherInts, c)
+		}
+
+		for offset := 0; offset+len(plainInts) <= len(cipherInts); offset++ {
+			score := 0.0
+			for i, plainInt := range plainInts {
+				possible := wheels.possibleDecryptions(network, start+offset+i, cipherInts[offset+i])
+				if possible&(1<<uint(plainInt)) == 0 {
+					score = -1
+					break
+				}
+				score += math.Log2(32 / float64(bits.OnesCount32(possible)))
+			}
+			if score >= 0 {
+				placements = append(placements, CribPlacement{Crib: Crib{Text: word, Offset: offset, Message: messageNumber}, Score: score})
+			}
+		}
+		start += len(cipherInts)
+	}
+
+	sort.SliceStable(placements, func(i, j int) bool {
+		return placements[i].Score > placements[j].Score
+	})
+	return placements, nil
+}
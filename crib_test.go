@@ -0,0 +1,199 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func countUnknownSpokes(wheels PartialWheels) int {
+	unknown := 0
+	for _, w := range wheels {
+		unknown += len(w.UnknownSpokes())
+	}
+	return unknown
+}
+
+func Test_CrackWithCribs(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	ciphertext := strings.Join(strings.Split(string(bts), "\n")[:300], "\n")
+
+	bts, err = ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintexts := strings.Split(string(bts), "\n")
+
+	withDefaults, err := CrackPartial(strings.NewReader(ciphertext), CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+
+	//Supplying the default cribs explicitly should make no difference
+	explicit, err := CrackPartial(strings.NewReader(ciphertext), CrackOptions{Cribs: []Crib{
+		Crib{Text: "UMUM4VEVE35", Offset: 0},
+		Crib{Text: "35", Offset: -2},
+	}})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	if countUnknownSpokes(explicit) != countUnknownSpokes(withDefaults) {
+		t.Errorf("Explicit default cribs learned %d unknown spokes, expected %d", countUnknownSpokes(explicit), countUnknownSpokes(withDefaults))
+	}
+
+	//Knowing the body of some of the messages should teach us more
+	cribs := append([]Crib{}, DEFAULT_CRIBS...)
+	for i, plaintext := range plaintexts[:20] {
+		cribs = append(cribs, Crib{Text: plaintext[11 : len(plaintext)-2], Offset: 11, Message: i + 1})
+	}
+	withBodies, err := CrackPartial(strings.NewReader(ciphertext), CrackOptions{Cribs: cribs})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	if countUnknownSpokes(withBodies) >= countUnknownSpokes(withDefaults) {
+		t.Errorf("Message bodies did not reduce the number of unknown spokes (%d, was %d)", countUnknownSpokes(withBodies), countUnknownSpokes(withDefaults))
+	}
+	for i, w := range withBodies {
+		for j, spoke := range w.Spokes {
+			if w.Size != 0 && spoke != nil && *spoke != TEST_CIPHERTEXT_SOLVED_WHEELS[i].Items[j] {
+				t.Errorf("Wheel %d spoke %d was learned incorrectly", i, j)
+			}
+		}
+	}
+}
+
+func Test_CribErrors(t *testing.T) {
+
+	cribs := []Crib{Crib{Text: "UMUM4", Offset: 0}, Crib{Text: "KING", Offset: 2, Message: 2}}
+	_, err := CrackPartial(strings.NewReader("BTEVUIO7WGRIDBEFFHSK6SOW6T\nTIDTWY4FINVPPUXOBUL7KNXT3GT6DKMLFNPHVD2XTU2PAMMFP"), CrackOptions{Cribs: cribs})
+	var malformed *MalformedLineError
+	if !errors.As(err, &malformed) || malformed.Line != 2 {
+		t.Errorf("Expected malformed line error for line 2, got %v", err)
+	}
+
+	_, err = CrackPartial(strings.NewReader("BTEVUIO7WGRIDBEFFHSK6SOW6T"), CrackOptions{Cribs: []Crib{Crib{Text: "HELLO WORLD"}}})
+	if err == nil {
+		t.Errorf("Expected an error for a crib that is not in the alphabet")
+	}
+
+	//Offsets count characters, not bytes, even when the alphabet's characters take several bytes
+	suffix := Crib{Text: "K↓", Offset: -2}
+	if plaintext, err := applyCribs([]Crib{suffix}, 5, 1, 1, ITA2_ALPHABET); err != nil || plaintext != "---K7" {
+		t.Errorf("Expected the suffix crib %q to read ---K7, got %q (%v)", suffix.Text, plaintext, err)
+	}
+}
+
+func Test_DragCrib(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	ciphertexts := strings.Split(string(bts), "\n")[:200]
+
+	bts, err = ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintexts := strings.Split(string(bts), "\n")
+
+	cracker := NewIncrementalCracker(CrackOptions{})
+	for i, ciphertext := range ciphertexts {
+		if err := cracker.AddMessage(ciphertext); err != nil {
+			t.Fatalf("Error adding message %d: %s", i, err.Error())
+		}
+	}
+	wheels := cracker.Status().Wheels
+	unknownBefore := countUnknownSpokes(wheels)
+
+	placements, err := DragCrib(ciphertexts, wheels, "4AND4", CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error dragging crib: %s", err.Error())
+	}
+	if len(placements) == 0 {
+		t.Fatalf("Expected at least one placement")
+	}
+	for i, placement := range placements {
+		plaintext := plaintexts[placement.Message-1]
+		if !strings.HasPrefix(plaintext[placement.Offset:], placement.Text) {
+			t.Errorf("Placement %d (message %d, offset %d) is not a real occurrence of the crib", i, placement.Message, placement.Offset)
+		}
+		if i > 0 && placement.Score > placements[i-1].Score {
+			t.Errorf("Placements are not ranked by score")
+		}
+	}
+
+	for _, placement := range placements {
+		if err := cracker.AddCrib(placement.Crib); err != nil {
+			t.Fatalf("Error adding crib: %s", err.Error())
+		}
+	}
+	if countUnknownSpokes(cracker.Status().Wheels) >= unknownBefore {
+		t.Errorf("Accepted placements did not reduce the number of unknown spokes")
+	}
+
+	//The crib does not fit in the first message at this offset
+	err = cracker.AddCrib(Crib{Text: "4AND4", Offset: 24, Message: 1})
+	var malformed *MalformedLineError
+	if !errors.As(err, &malformed) || malformed.Line != 1 {
+		t.Errorf("Expected malformed line error for message 1, got %v", err)
+	}
+}
+
+func Test_DragCribOtherMachine(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintexts := strings.Split(string(bts), "\n")[:200]
+	for i := range plaintexts {
+		plaintexts[i], _ = BLETCHLEY_ALPHABET.Translate(plaintexts[i], TUNNY_ALPHABET)
+	}
+
+	opts := CrackOptions{Network: PermutationNetwork{{3, 4}, {2, 3}, {1, 2}, {0, 1}, {0, 4}}, Alphabet: TUNNY_ALPHABET}
+	m, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, opts.Network)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Alphabet = opts.Alphabet
+	m.Reset()
+
+	//Leave a blank line after every tenth message; they must not be counted as messages
+	cracker := NewIncrementalCracker(opts)
+	ciphertexts := []string{}
+	for i, plaintext := range plaintexts {
+		ciphertext, err := m.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		if err := cracker.AddMessage(ciphertext); err != nil {
+			t.Fatalf("Error adding message %d: %s", i, err.Error())
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+		if i%10 == 9 {
+			ciphertexts = append(ciphertexts, "")
+		}
+	}
+
+	placements, err := DragCrib(ciphertexts, cracker.Status().Wheels, "9AND9", opts)
+	if err != nil {
+		t.Fatalf("Error dragging crib: %s", err.Error())
+	}
+	if len(placements) == 0 {
+		t.Fatalf("Expected at least one placement")
+	}
+	for i, placement := range placements {
+		if !strings.HasPrefix(plaintexts[placement.Message-1][placement.Offset:], placement.Text) {
+			t.Errorf("Placement %d (message %d, offset %d) is not a real occurrence of the crib", i, placement.Message, placement.Offset)
+		}
+		if err := cracker.AddCrib(placement.Crib); err != nil {
+			t.Fatalf("Error adding crib: %s", err.Error())
+		}
+	}
+}
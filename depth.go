@@ -0,0 +1,405 @@
+package geheimschreiber
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+//DEFAULT_DEPTH_SIGMA is how far above chance (in standard deviations) the coincidences between two messages
+//must be before FindDepths reports them as being in depth
+var DEFAULT_DEPTH_SIGMA = 5.0
+
+//DEPTH_BEAM_WIDTH is the number of partial readings that ReadDepth keeps at each position
+var DEPTH_BEAM_WIDTH = 64
+
+//Depth is a group of messages that appear to have been enciphered from the same wheel start
+type Depth struct {
+	//Messages holds the indices of the messages in the group, in increasing order
+	Messages []int
+
+	//Coincidences is the number of positions, over every pair of messages in the group, at which
+	//both messages have the same ciphertext character; Compared is the number of positions compared
+	Coincidences int
+	Compared     int
+
+	//Sigma is how far Coincidences is above what we would expect by chance, in standard deviations
+	Sigma float64
+}
+
+//KeystreamCharacter is the effect of the wheels on a single character
+type KeystreamCharacter struct {
+	//XOR holds the bits of wheels 0-4, with wheel 0 as the most significant bit
+	//(or of the controls 0-4, on a machine whose controls combine several wheels)
+	XOR int
+
+	//Transpose holds the bits of wheels 5-9, with wheel 5 as the most significant bit
+	//(or of the controls 5-9)
+	Transpose int
+}
+
+//DepthReading is the plaintext and keystream that ReadDepth recovered from a group of messages in depth
+type DepthReading struct {
+	//Plaintexts holds the reading of each message, cut off at the end of the shortest message
+	Plaintexts []string
+
+	//Keystream holds a setting of the wheels at each position that enciphers every reading to its ciphertext
+	//Several settings may do so; if they do, one of them is chosen arbitrarily
+	Keystream []KeystreamCharacter
+}
+
+//FindDepths looks for groups of messages (one per string) that were enciphered from the same wheel start
+//Wherever two such messages have the same plaintext character, they have the same ciphertext character,
+//so they agree far more often than the 1 in 32 that we would expect from messages on different keys
+//Every pair of messages that agree at least DEFAULT_DEPTH_SIGMA standard deviations more often than chance
+//is put in the same group; the groups are returned with the strongest first
+//The messages are written in alphabet; if it is nil, BLETCHLEY_ALPHABET is used
+//Short messages give little evidence either way, so depths between them may be missed
+func FindDepths(messages []string, alphabet *Alphabet) ([]Depth, error) {
+	cipherInts, err := messagesToInts(messages, alphabet.orDefault())
+	if err != nil {
+		return nil, err
+	}
+
+	//Join the pairs that are in depth into groups
+	groups := make([]int, len(messages))
+	for i := range groups {
+		groups[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if groups[i] != i {
+			groups[i] = find(groups[i])
+		}
+		return groups[i]
+	}
+	for i := range cipherInts {
+		for j := i + 1; j < len(cipherInts); j++ {
+			coincidences, compared := countCoincidences(cipherInts[i], cipherInts[j])
+			if coincidenceSigma(coincidences, compared) >= DEFAULT_DEPTH_SIGMA {
+				groups[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]int{}
+	for i := range messages {
+		members[find(i)] = append(members[find(i)], i)
+	}
+
+	depths := []Depth{}
+	for _, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		depth := Depth{Messages: group}
+		for a := range group {
+			for b := a + 1; b < len(group); b++ {
+				coincidences, compared := countCoincidences(cipherInts[group[a]], cipherInts[group[b]])
+				depth.Coincidences += coincidences
+				depth.Compared += compared
+			}
+		}
+		depth.Sigma = coincidenceSigma(depth.Coincidences, depth.Compared)
+		depths = append(depths, depth)
+	}
+	sort.Slice(depths, func(i, j int) bool {
+		if depths[i].Sigma != depths[j].Sigma {
+			return depths[i].Sigma > depths[j].Sigma
+		}
+		return depths[i].Messages[0] < depths[j].Messages[0]
+	})
+	return depths, nil
+}
+
+//messagesToInts converts each message, written in the given alphabet, to the integer representation of its characters
+func messagesToInts(messages []string, alphabet *Alphabet) ([][]int, error) {
+	cipherInts := make([][]int, len(messages))
+	for i, message := range messages {
+		ciphertext, _, err := parseMessage(strings.TrimRight(message, "\r\n"), []Crib{}, i+1, i+1, alphabet)
+		if err != nil {
+			return nil, err
+		}
+		cipherInts[i] = make([]int, len(ciphertext))
+		for j := range ciphertext {
+			cipherInts[i][j], _ = BLETCHLEY_ALPHABET.Code(rune(ciphertext[j]))
+		}
+	}
+	return cipherInts, nil
+}
+
+//countCoincidences compares two messages from their first character, and counts the positions
+//at which they have the same character
+func countCoincidences(a, b []int) (coincidences, compared int) {
+	compared = len(a)
+	if len(b) < compared {
+		compared = len(b)
+	}
+	for i := 0; i < compared; i++ {
+		if a[i] == b[i] {
+			coincidences++
+		}
+	}
+	return coincidences, compared
+}
+
+//coincidenceSigma returns how far the number of coincidences is above chance, in standard deviations
+func coincidenceSigma(coincidences, compared int) float64 {
+	if compared == 0 {
+		return 0
+	}
+	const p = 1.0 / 32
+	n := float64(compared)
+	return (float64(coincidences) - n*p) / math.Sqrt(n*p*(1-p))
+}
+
+//depthCandidate is one way of reading every message in a depth at a single position
+type depthCandidate struct {
+	plainInts []int
+	key       KeystreamCharacter
+}
+
+//depthState is a partial reading of a depth, ending at one of the candidates for its last position
+type depthState struct {
+	candidate int
+	score     float64
+	previous  *depthState
+
+	//context holds the last N-1 characters of each message, indexed as in ngramIndex
+	context []int
+
+	//history identifies the candidates at the last N-1 positions (most recent first); they are all that
+	//the model needs in order to score what comes next, so of two states with the same history only the better is kept
+	history [3]int
+}
+
+//depthExtension is a depth state extended by a candidate for the next position
+type depthExtension struct {
+	state     *depthState
+	candidate int
+	score     float64
+}
+
+//depthExtensions is a min-heap of extensions, ordered by score
+type depthExtensions []depthExtension
+
+func (h depthExtensions) Len() int            { return len(h) }
+func (h depthExtensions) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h depthExtensions) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *depthExtensions) Push(x interface{}) { *h = append(*h, x.(depthExtension)) }
+func (h *depthExtensions) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+//ReadDepth makes a rough first pass at the plaintext of a group of messages (such as one found by FindDepths)
+//that were enciphered from the same wheel start, and at the keystream that they were enciphered with,
+//without knowing any of the plaintext or wheels
+//At each position, every message was enciphered with the same setting of the ten wheels, so not every
+//combination of plaintext characters is possible; but a few hundred are (224 for two messages), and
+//ReadDepth can only pick the combinations that model scores highest
+//It does not decrypt the messages: with a trigram model trained on a few thousand words, expect about a
+//quarter of the characters of a three-message depth to be right, and fewer of a two-message depth.
+//The reading is a starting point for finding cribs and correcting by hand; the more messages in the depth,
+//and the better model resembles their language, the better it is
+//The messages are written in opts.Alphabet, as the reading is, and deciphered through opts.Network; the other
+//options are not used
+func ReadDepth(messages []string, model *NgramModel, opts CrackOptions) (*DepthReading, error) {
+	if model == nil {
+		return nil, errors.New("error: a language model is required to read a depth")
+	}
+	if len(messages) < 2 {
+		return nil, errors.New("error: a depth needs at least two messages")
+	}
+	alphabet := opts.Alphabet.orDefault()
+	cipherInts, err := messagesToInts(messages, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	network := opts.Network.orDefault()
+	return readDepth(cipherInts, model, alphabet, func(position int) []depthCandidate {
+		return depthCandidates(cipherInts, network, position)
+	}, nil)
+}
+
+//readDepth reads a depth by beam search, given the candidates for each position, and writes the reading in the alphabet
+//If transition is not nil, it gives the log probability of each candidate following the one before it
+func readDepth(cipherInts [][]int, model *NgramModel, alphabet *Alphabet, candidatesAt func(position int) []depthCandidate, transition func(position int, previous, next depthCandidate) float64) (*DepthReading, error) {
+	length := len(cipherInts[0])
+	for _, ints := range cipherInts {
+		if len(ints) < length {
+			length = len(ints)
+		}
+	}
+
+	marginals := model.marginalLogProbs()
+	contextMask := 1<<(5*uint(model.N-1)) - 1
+	beam := []*depthState{{candidate: -1, context: make([]int, len(cipherInts))}}
+	candidates := make([][]depthCandidate, length)
+	for position := 0; position < length; position++ {
+		candidates[position] = candidatesAt(position)
+
+		//The model can only look back as far as the start of the messages
+		order := model.N
+		if position+1 < order {
+			order = position + 1
+		}
+		mask := 1<<(5*uint(order)) - 1
+
+		//Extensions of states that share all but the oldest candidate in their history would
+		//share a history, so only the best of them needs to be kept
+		groups := map[[3]int]int{}
+		for _, state := range beam {
+			prefix := state.history
+			if model.N > 1 {
+				prefix[model.N-2] = -1
+			}
+			if _, ok := groups[prefix]; !ok {
+				groups[prefix] = len(groups)
+			}
+		}
+
+		best := make([]depthExtension, len(groups)*len(candidates[position]))
+		for _, state := range beam {
+			prefix := state.history
+			if model.N > 1 {
+				prefix[model.N-2] = -1
+			}
+			group := best[groups[prefix]*len(candidates[position]):]
+
+			base := state.score
+			for _, context := range state.context {
+				base -= marginals[order-1][context&(mask>>5)]
+			}
+			for c, candidate := range candidates[position] {
+				score := base
+				if transition != nil && state.candidate >= 0 {
+					score += transition(position, candidates[position-1][state.candidate], candidate)
+				}
+				for m, p := range candidate.plainInts {
+					score += marginals[order][(state.context[m]<<5|p)&mask]
+				}
+				if group[c].state == nil || score > group[c].score {
+					group[c] = depthExtension{state: state, candidate: c, score: score}
+				}
+			}
+		}
+
+		//Keep the best extensions
+		extensions := &depthExtensions{}
+		for _, e := range best {
+			if e.state == nil {
+				continue
+			}
+			if extensions.Len() < DEPTH_BEAM_WIDTH {
+				heap.Push(extensions, e)
+			} else if e.score > (*extensions)[0].score {
+				(*extensions)[0] = e
+				heap.Fix(extensions, 0)
+			}
+		}
+		sort.Slice(*extensions, func(i, j int) bool { return (*extensions)[i].score > (*extensions)[j].score })
+
+		beam = make([]*depthState, len(*extensions))
+		for i, e := range *extensions {
+			state := &depthState{candidate: e.candidate, score: e.score, previous: e.state, context: make([]int, len(cipherInts))}
+			for m, p := range candidates[position][e.candidate].plainInts {
+				state.context[m] = (e.state.context[m]<<5 | p) & contextMask
+			}
+			if model.N > 1 {
+				state.history[0] = e.candidate
+				copy(state.history[1:model.N-1], e.state.history[:])
+			}
+			beam[i] = state
+		}
+	}
+
+	reading := &DepthReading{
+		Plaintexts: make([]string, len(cipherInts)),
+		Keystream:  make([]KeystreamCharacter, length),
+	}
+	plaintexts := make([][]rune, len(cipherInts))
+	for m := range plaintexts {
+		plaintexts[m] = make([]rune, length)
+	}
+	position := length - 1
+	for state := beam[0]; position >= 0; state = state.previous {
+		candidate := candidates[position][state.candidate]
+		for m, p := range candidate.plainInts {
+			plaintexts[m][position] = alphabet.Symbol(p)
+		}
+		reading.Keystream[position] = candidate.key
+		position--
+	}
+	for m := range plaintexts {
+		reading.Plaintexts[m] = string(plaintexts[m])
+	}
+	return reading, nil
+}
+
+//depthCandidates returns every distinct way of reading the messages at the given position,
+//through the network, along with a keystream character that gives each one
+func depthCandidates(cipherInts [][]int, network PermutationNetwork, position int) []depthCandidate {
+	candidates := []depthCandidate{}
+	seen := map[int]bool{}
+	for setting := 0; setting < 1<<10; setting++ {
+		var bits [10]int
+		for i := range bits {
+			bits[i] = getNthBit(setting, i)
+		}
+
+		plainInts := make([]int, len(cipherInts))
+		key := 0
+		for m := range cipherInts {
+			plainInts[m] = network.decryptWithBits(cipherInts[m][position], bits)
+			key = key<<5 | plainInts[m]
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, depthCandidate{plainInts: plainInts, key: settingToKeystream(setting)})
+	}
+	return candidates
+}
+
+//settingToKeystream converts a setting of the wheels (bit i is the bit on wheel i) to a KeystreamCharacter
+func settingToKeystream(setting int) KeystreamCharacter {
+	var k KeystreamCharacter
+	for i := 0; i < 5; i++ {
+		k.XOR |= getNthBit(setting, i) << (4 - uint(i))
+		k.Transpose |= getNthBit(setting, 5+i) << (4 - uint(i))
+	}
+	return k
+}
+
+//marginalLogProbs returns, for every k from 1 to N, the log probability of every k-gram (indexed as
+//in ngramIndex) appearing at the start of an n-gram; entry 0 is a single zero,
+//so that the first character of a message is scored by its probability alone
+func (m *NgramModel) marginalLogProbs() [][]float64 {
+	marginals := make([][]float64, m.N+1)
+	marginals[0] = []float64{0}
+
+	probs := make([]float64, len(m.logProbs))
+	for index, logProb := range m.logProbs {
+		probs[index] = math.Exp(logProb)
+	}
+	for k := m.N; k >= 1; k-- {
+		marginals[k] = make([]float64, 1<<uint(5*k))
+		for index, prob := range probs {
+			marginals[k][index] = math.Log(prob)
+		}
+
+		//Sum over the last character to get the probabilities of the (k-1)-grams
+		shorter := make([]float64, len(probs)/32)
+		for index, prob := range probs {
+			shorter[index>>5] += prob
+		}
+		probs = shorter
+	}
+	return marginals
+}
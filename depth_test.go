@@ -0,0 +1,163 @@
+package geheimschreiber
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+//depthTestMessages splits the test plaintext into long messages, and enciphers each one through the network with
+//the message key numbered keyIndices[i], so messages with the same number are in depth
+func depthTestMessages(t *testing.T, keyIndices []int, network PermutationNetwork) (plaintexts, ciphertexts []string) {
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	lines := strings.Split(strings.Replace(string(bts), "\r", "", -1), "\n")
+
+	m, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, network)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	rng := rand.New(rand.NewSource(3))
+	keys := map[int]MessageKey{}
+	for i, keyIndex := range keyIndices {
+		if _, ok := keys[keyIndex]; !ok {
+			key := make(MessageKey, 10)
+			for j := range key {
+				key[j] = rng.Intn(TEST_CIPHERTEXT_SOLVED_WHEELS[j].MaxSize)
+			}
+			keys[keyIndex] = key
+		}
+
+		plaintext := strings.Join(lines[20*i:20*(i+1)], "")
+		if err := SetMessageKey(m.Wheels(), keys[keyIndex]); err != nil {
+			t.Fatalf("Error setting message key %d: %s", i, err.Error())
+		}
+		ciphertext, err := m.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting message %d: %s", i, err.Error())
+		}
+		plaintexts = append(plaintexts, plaintext)
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	ResetWheels(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	return plaintexts, ciphertexts
+}
+
+func Test_FindDepths(t *testing.T) {
+
+	//Messages 0 and 5 share a key, as do messages 2, 7 and 9
+	_, ciphertexts := depthTestMessages(t, []int{0, 1, 2, 3, 4, 0, 6, 2, 8, 2, 10, 11}, DEFAULT_NETWORK)
+
+	depths, err := FindDepths(ciphertexts, nil)
+	if err != nil {
+		t.Fatalf("Error finding depths: %s", err.Error())
+	}
+	found := []string{}
+	for _, depth := range depths {
+		found = append(found, fmt.Sprint(depth.Messages))
+	}
+	if strings.Join(found, " ") != "[2 7 9] [0 5]" {
+		t.Errorf("Found depths %v, expected [2 7 9] [0 5]", found)
+	}
+
+	//The same messages in another notation are in the same depths
+	ita2 := make([]string, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		ita2[i], _ = BLETCHLEY_ALPHABET.Translate(ciphertext, ITA2_ALPHABET)
+	}
+	ita2Depths, err := FindDepths(ita2, ITA2_ALPHABET)
+	if err != nil {
+		t.Fatalf("Error finding depths in ITA2: %s", err.Error())
+	}
+	if len(ita2Depths) != len(depths) || fmt.Sprint(ita2Depths[0]) != fmt.Sprint(depths[0]) {
+		t.Errorf("Found depths %v in ITA2, expected %v", ita2Depths, depths)
+	}
+}
+
+func Test_ReadDepth(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+
+	//Train on the rest of the play, after the lines that make up the messages
+	lines := strings.Split(string(bts), "\n")
+	model, err := TrainNgramModel(strings.NewReader(strings.Join(lines[20*3:], "\n")), 3)
+	if err != nil {
+		t.Fatalf("Error training model: %s", err.Error())
+	}
+
+	//The depth must be read through whichever network sent it
+	for _, network := range []PermutationNetwork{DEFAULT_NETWORK, {{1, 3}, {0, 2}, {2, 4}, {0, 1}, {3, 4}}} {
+		plaintexts, ciphertexts := depthTestMessages(t, []int{0, 0, 0}, network)
+		opts := CrackOptions{Network: network}
+
+		reading, err := ReadDepth(ciphertexts, model, opts)
+		if err != nil {
+			t.Fatalf("Error reading depth: %s", err.Error())
+		}
+		correct, total := countCorrectReading(reading, plaintexts)
+
+		//Without a model, every reading is as good as any other, so the reading is little better than chance
+		baseline, err := ReadDepth(ciphertexts, &NgramModel{N: 1, logProbs: make([]float64, 32)}, opts)
+		if err != nil {
+			t.Fatalf("Error reading depth: %s", err.Error())
+		}
+		correctByChance, _ := countCorrectReading(baseline, plaintexts)
+
+		//ReadDepth is only a rough first pass, so it need only read a fifth of the characters correctly,
+		//but far more than without a model
+		if correct < total/5 || correct < 5*correctByChance {
+			t.Errorf("Network %v: only %d of %d characters were read correctly, and %d without a model", network, correct, total, correctByChance)
+		}
+
+		//The keystream must encipher the reading to the ciphertext
+		for m, plaintext := range reading.Plaintexts {
+			for i, k := range reading.Keystream {
+				var bits [10]int
+				for j := 0; j < 5; j++ {
+					bits[j] = getNthBit(k.XOR, 4-j)
+					bits[5+j] = getNthBit(k.Transpose, 4-j)
+				}
+				p, _ := BLETCHLEY_ALPHABET.Code(rune(plaintext[i]))
+				c, _ := BLETCHLEY_ALPHABET.Code(rune(ciphertexts[m][i]))
+				if network.encryptWithBits(p, bits) != c {
+					t.Fatalf("Network %v: keystream at position %d does not encipher message %d", network, i, m)
+				}
+			}
+		}
+
+		//Messages in another notation are read the same way, and the reading is written in it
+		ita2 := make([]string, len(ciphertexts))
+		for m, ciphertext := range ciphertexts {
+			ita2[m], _ = BLETCHLEY_ALPHABET.Translate(ciphertext, ITA2_ALPHABET)
+		}
+		ita2Reading, err := ReadDepth(ita2, model, CrackOptions{Network: network, Alphabet: ITA2_ALPHABET})
+		if err != nil {
+			t.Fatalf("Error reading depth in ITA2: %s", err.Error())
+		}
+		for m, plaintext := range reading.Plaintexts {
+			if expected, _ := BLETCHLEY_ALPHABET.Translate(plaintext, ITA2_ALPHABET); ita2Reading.Plaintexts[m] != expected {
+				t.Errorf("Network %v: message %d reads differently in ITA2", network, m)
+			}
+		}
+	}
+}
+
+//countCorrectReading counts the characters of the reading that match the plaintexts
+func countCorrectReading(reading *DepthReading, plaintexts []string) (correct, total int) {
+	for m, plaintext := range reading.Plaintexts {
+		for i := range plaintext {
+			if plaintext[i] == plaintexts[m][i] {
+				correct++
+			}
+			total++
+		}
+	}
+	return correct, total
+}
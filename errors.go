@@ -0,0 +1,78 @@
+package geheimschreiber
+
+import "fmt"
+
+//InsufficientTrafficError is returned when the intercepted traffic does not contain enough
+//known plaintext to determine every wheel
+//Spoke is -1 if the size of the wheel could not be determined
+type InsufficientTrafficError struct {
+	Wheel int
+	Spoke int
+}
+
+func (e *InsufficientTrafficError) Error() string {
+	if e.Spoke < 0 {
+		return fmt.Sprintf("error: insufficient traffic to determine the size of wheel %d", e.Wheel)
+	}
+	return fmt.Sprintf("error: insufficient traffic to determine wheel %d spoke %d", e.Wheel, e.Spoke)
+}
+
+//InconsistentBitError is returned when the traffic implies two different values for the same spoke,
+//or when no wheel size is consistent with the bits learned for a wheel
+//Position is the index into the message stream at which the conflict was found, or -1 if
+//the conflict is between the learned bits and every possible wheel size
+//Wheel is -1 if the conflict cannot be attributed to a single wheel
+type InconsistentBitError struct {
+	Wheel    int
+	Position int
+}
+
+func (e *InconsistentBitError) Error() string {
+	if e.Wheel < 0 {
+		return fmt.Sprintf("error: inconsistent bits at position %d", e.Position)
+	}
+	if e.Position < 0 {
+		return fmt.Sprintf("error: no wheel size is consistent with the bits learned for wheel %d", e.Wheel)
+	}
+	return fmt.Sprintf("error: inconsistent bit at position %d for wheel %d", e.Position, e.Wheel)
+}
+
+//MalformedLineError is returned when a line of intercepted traffic cannot be parsed
+//Line counts from 1
+type MalformedLineError struct {
+	Line   int
+	Reason string
+}
+
+func (e *MalformedLineError) Error() string {
+	return fmt.Sprintf("error: malformed line %d: %s", e.Line, e.Reason)
+}
+
+//MessageKeyError is returned when the message key for a line of intercepted traffic cannot be recovered
+//Err is ErrAmbiguousMessageKey or ErrNoMessageKey
+type MessageKeyError struct {
+	Line int
+	Err  error
+}
+
+func (e *MessageKeyError) Error() string {
+	return fmt.Sprintf("%s (line %d)", e.Err.Error(), e.Line)
+}
+
+func (e *MessageKeyError) Unwrap() error {
+	return e.Err
+}
+
+//InvalidWheelError is returned when a set of wheels cannot be put on a Machine
+//Wheel is -1 if the problem is with the set of wheels as a whole
+type InvalidWheelError struct {
+	Wheel  int
+	Reason string
+}
+
+func (e *InvalidWheelError) Error() string {
+	if e.Wheel < 0 {
+		return fmt.Sprintf("error: invalid wheels: %s", e.Reason)
+	}
+	return fmt.Sprintf("error: invalid wheel %d: %s", e.Wheel, e.Reason)
+}
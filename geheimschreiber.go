@@ -2,11 +2,13 @@ package geheimschreiber
 
 import (
 	"bufio"
-	"errors"
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"regexp"
+	"strings"
 )
 
 var WHEEL_SIZES = []int{47, 53, 59, 61, 64, 65, 67, 69, 71, 73}
@@ -67,6 +69,10 @@ func FindUniqueBitIndex(i int) (index int, err error) {
 var ZERO = 0
 var ONE = 1
 
+//TRANSPOSITION_PATTERN is what moving a single bit tells us about the transpose wheels of DEFAULT_NETWORK,
+//indexed by where the bit started and where it ended up, as in PermutationNetwork.InferenceTable
+//
+//Deprecated: use DEFAULT_NETWORK.InferenceTable(), or the InferenceTable of the machine's own network
 var TRANSPOSITION_PATTERN = [][][]*int{
 	[][]*int{
 		[]*int{&ZERO, &ZERO, nil, nil, nil},
@@ -106,66 +112,13 @@ var TRANSPOSITION_PATTERN = [][][]*int{
 	},
 }
 
-//inferTransposeBits takes a source integer and a destination integer corresponding to
-//(plaintext XORed with wheels 0-4) and ciphertext, respectively
-//It returns what we know about the transpose wheels (wheels 5-9)
-func inferTransposeBits(source, dest int) []*int {
-	return TRANSPOSITION_PATTERN[source][dest]
-}
-
 // TRANSPOSE_PROBS[i][j] is prob ci ends up in j'th bit
 var TRANSPOSE_PROBS = [][]float64{
 	[]float64{0.25, 0.125, 0.0625, 0.25 + 0.03125, 0.25 + 0.03125},
 	[]float64{0.5, 0.25, 0.125, 0.0625, 0.0625},
 	[]float64{0, 0.5, 0.25, 0.125, 0.125},
 	[]float64{0, 0, 0.5, 0.25, 0.25},
-	[]float64{0.25, 0.125, 0.0625, 0.03125 + 0.25, 0.03125 + 0.025}}
-
-var alphabet = map[string]int{
-	"2": 0,
-	"T": 1,
-	"3": 2,
-	"O": 3,
-	"4": 4,
-	"H": 5,
-	"N": 6,
-	"M": 7,
-	"5": 8,
-	"L": 9,
-	"R": 10,
-	"G": 11,
-	"I": 12,
-	"P": 13,
-	"C": 14,
-	"V": 15,
-	"E": 16,
-	"Z": 17,
-	"D": 18,
-	"B": 19,
-	"S": 20,
-	"Y": 21,
-	"F": 22,
-	"X": 23,
-	"A": 24,
-	"W": 25,
-	"J": 26,
-	"6": 27,
-	"U": 28,
-	"Q": 29,
-	"K": 30,
-	"7": 31,
-}
-
-//Brute force
-//TODO do better
-func invertAlphabet(i int) (string, error) {
-	for key, val := range alphabet {
-		if val == i {
-			return key, nil
-		}
-	}
-	return "", errors.New("matching key not found in alphabet")
-}
+	[]float64{0.25, 0.125, 0.0625, 0.03125 + 0.25, 0.03125 + 0.25}}
 
 type Wheel struct {
 	Items        []int
@@ -227,117 +180,36 @@ func xorCurrentCharacter(wheels []*Wheel, input int) int {
 	return input
 }
 
+//EncryptString encrypts the plaintext with the ten wheels, continuing from their current positions
+//It returns an InvalidWheelError if the wheels cannot be put on a Machine
 func EncryptString(wheels []*Wheel, plaintext string) (string, error) {
-	result := ""
-	for _, character := range plaintext {
-
-		char := string(character)
-		if char == "\n" || char == "\r" {
-
-			result += char
-			continue
-		}
-		encrypted, err := encryptCharacter(wheels, char)
-		if err != nil {
-			return "", err
-		}
-		result += encrypted
+	m, err := NewMachine(wheels)
+	if err != nil {
+		return "", err
 	}
-	return result, nil
+	return m.Encrypt(plaintext)
 }
 
-//EncryptCharacter takes a single character and encrypts it with all ten wheels in Wheels
-func encryptCharacter(wheels []*Wheel, char string) (string, error) {
-
-	c, ok := alphabet[char]
-	if !ok {
-		log.Printf("Cannot find character %s adf", char)
-		return "", errors.New("error: character not in alphabet")
-	}
-
-	var i uint8
-	for i = 0; i < 5; i++ {
-		current_bit := wheels[i].CurrentBit()
-		c = (c ^ (current_bit << (4 - i))) //
-	}
-
-	if wheels[5].CurrentBit() == 1 {
-		c = interchangeBits(c, 0, 4)
-	}
-
-	if wheels[6].CurrentBit() == 1 {
-		c = interchangeBits(c, 0, 1)
-	}
-
-	if wheels[7].CurrentBit() == 1 {
-		c = interchangeBits(c, 1, 2)
-	}
-
-	if wheels[8].CurrentBit() == 1 {
-		c = interchangeBits(c, 2, 3)
-	}
-
-	if wheels[9].CurrentBit() == 1 {
-		c = interchangeBits(c, 3, 4)
-	}
-
-	encrypted_character, err := invertAlphabet(c)
-	return encrypted_character, err
+//encryptWithBits encrypts the integer representation of a character with DEFAULT_NETWORK,
+//given the current bit on each of the ten wheels
+func encryptWithBits(c int, bits [10]int) int {
+	return DEFAULT_NETWORK.encryptWithBits(c, bits)
 }
 
+//DecryptString decrypts the ciphertext with the ten wheels, continuing from their current positions
+//It returns an InvalidWheelError if the wheels cannot be put on a Machine
 func DecryptString(wheels []*Wheel, ciphertext string) (string, error) {
-	result := ""
-	for _, character := range ciphertext {
-
-		char := string(character)
-		if char == "\n" || char == "\r" {
-			result += char
-			continue
-		}
-		decrypted, err := decryptCharacter(wheels, char)
-		if err != nil {
-			return "", err
-		}
-		result += decrypted
+	m, err := NewMachine(wheels)
+	if err != nil {
+		return "", err
 	}
-	return result, nil
+	return m.Decrypt(ciphertext)
 }
 
-func decryptCharacter(wheels []*Wheel, char string) (string, error) {
-	c, ok := alphabet[char]
-	if !ok {
-		return "", errors.New("error: character not in alphabet")
-	}
-
-	if wheels[9].CurrentBit() == 1 {
-		c = interchangeBits(c, 3, 4)
-	}
-
-	if wheels[8].CurrentBit() == 1 {
-		c = interchangeBits(c, 2, 3)
-	}
-
-	if wheels[7].CurrentBit() == 1 {
-		c = interchangeBits(c, 1, 2)
-	}
-
-	if wheels[6].CurrentBit() == 1 {
-		c = interchangeBits(c, 0, 1)
-	}
-	if wheels[5].CurrentBit() == 1 {
-		c = interchangeBits(c, 0, 4)
-	}
-
-	//Order of XOR doesn't matter
-	var i uint8
-	for i = 0; i < 5; i++ {
-		current_bit := wheels[i].CurrentBit()
-		c = (c ^ (current_bit << (4 - i))) //
-	}
-
-	decrypted_character, err := invertAlphabet(c)
-	return decrypted_character, err
-
+//decryptWithBits decrypts the integer representation of a character with DEFAULT_NETWORK,
+//given the current bit on each of the ten wheels
+func decryptWithBits(c int, bits [10]int) int {
+	return DEFAULT_NETWORK.decryptWithBits(c, bits)
 }
 
 //getNthBit returns the nth bit from the right (ie, place value 2^n)
@@ -405,147 +277,129 @@ func parseCiphertext(filename string) (string, string) {
 		fmt.Printf("error opening file: %v\n", err)
 		panic(err)
 	}
+	defer f.Close()
 
-	ciphertext := ""
-	plaintext := ""
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		currentLine := scanner.Text()
-		//Assume every line is at least 13 characters
+	ciphertext, plaintext, err := parseIntercepts(f, DEFAULT_CRIBS, BLETCHLEY_ALPHABET)
+	if err != nil {
+		panic(err)
+	}
+	return ciphertext, plaintext
+}
 
-		plaintext += "UMUM4VEVE35"
-		ciphertext += currentLine[:11]
+//parseIntercepts reads a series of encrypted messages (one per line), written in the given alphabet, and returns
+//the ciphertext as a single stream, along with the plaintext that the cribs tell us for that stream, both rewritten
+//in BLETCHLEY_ALPHABET
+//Positions whose plaintext is unknown are marked with "-" in the plaintext
+//Blank lines are ignored, since they do not advance the wheels
+func parseIntercepts(r io.Reader, cribs []Crib, alphabet *Alphabet) (string, string, error) {
+
+	var ciphertext, plaintext bytes.Buffer
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	messageNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		currentLine := strings.TrimRight(scanner.Text(), "\r")
+		if currentLine == "" {
+			continue
+		}
+		messageNumber++
 
-		for _, _ = range currentLine[12 : len(currentLine)-1] {
-			ciphertext += "-"
-			plaintext += "-"
+		c, p, err := parseMessage(currentLine, cribs, messageNumber, lineNumber, alphabet)
+		if err != nil {
+			return "", "", err
 		}
-		ciphertext += currentLine[len(currentLine)-2:]
-		plaintext += "35"
+		ciphertext.WriteString(c)
+		plaintext.WriteString(p)
 
 	}
 	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, "reading standard input:", err)
+		return "", "", err
 	}
 
-	ciphertext = REMOVE_WHITESPACE_REGEX.ReplaceAllString(ciphertext, "")
-	return ciphertext, plaintext
+	return ciphertext.String(), plaintext.String(), nil
 
 }
 
-//func learnFirstFiveWheels learns all spoke values from the first five wheels
-//This happens to work for the plaintext/ciphertext pair that we used for testing; it is not guaranteed to work for all texts, particularly shorter texts
-func learnFirstFiveWheels(learnedWheels [][]*int, plaintext string, ciphertext string) {
+//parseMessage returns the ciphertext of a single message, along with the plaintext that the cribs tell us for it,
+//both rewritten from the given alphabet in BLETCHLEY_ALPHABET
+//lineNumber is only used to report errors
+func parseMessage(message string, cribs []Crib, messageNumber int, lineNumber int, alphabet *Alphabet) (string, string, error) {
 
-	//TODO don't use a global variable (learnedWheels) to store the results
+	var ciphertext strings.Builder
+	for _, character := range message {
+		c, ok := alphabet.Code(character)
+		if !ok {
+			return "", "", &MalformedLineError{Line: lineNumber, Reason: fmt.Sprintf("character %q not in alphabet", character)}
+		}
+		ciphertext.WriteRune(BLETCHLEY_ALPHABET.Symbol(c))
+	}
 
-	// Iterate across plaintext. For each character:
-	// For each bit c0-c4:
-	// Examine all possible destination bits for ci
-	// Add p to implied element of appropriate spoke's pair
+	plaintext, err := applyCribs(cribs, ciphertext.Len(), messageNumber, lineNumber, alphabet)
+	if err != nil {
+		return "", "", err
+	}
+	return ciphertext.String(), plaintext, nil
+}
 
-	// Examine all observed spoke 0-1 pairs. For all that pass a threshold, declare it 0 or 1.
-	// Abort if any spoke fails this threshold.
+//func learnFirstFiveWheels learns the bits of the first five wheels (the XOR wheels) from a single character
+//This happens to work for the plaintext/ciphertext pair that we used for testing; it is not guaranteed to work for all texts, particularly shorter texts
+//It returns the bits of wheels 0-4 as a mask (wheel 0 the most significant bit), or false if the character reveals nothing about them
+func learnFirstFiveWheels(plainInt, cipherInt int) (mask int, ok bool) {
 
-	//Iterate over plaintext and ciphertext in lockstep
 	// For each cipherchar 2 or 7 encountered:
 	// Learn b0-b4 and save to appropriate slot on each wheel
-	// If all b0-b4 learned:
-	// Else:
-	for index, plainRune := range plaintext {
-		plainChar := string(plainRune)
-		if plainChar == "-" {
-			continue
-		}
-
-		plainInt := alphabet[plainChar]
-
-		cipherRune := rune(ciphertext[index])
-		cipherChar := string(cipherRune)
-
-		cipherInt := alphabet[cipherChar]
-
-		if cipherInt == 0 || cipherInt == 31 {
-			//All output bits were 0, so we know that EVERY plaintext bit XORed with b_{i} to 0, for all i
-			//To learn the bits b_{i}, we XOR again and store into the appropriate b_{i} slot
-
-			mask := cipherInt ^ plainInt
-
-			//Store each bit of mask in the appropriate b_{i} slot
-
-			for i := 0; i < 5; i++ {
-				bi := getNthBit(mask, 4-i)
-
-				if learnedWheels[i][index%LARGE_WHEEL_SIZES[i]] != nil && *learnedWheels[i][index%LARGE_WHEEL_SIZES[i]] != bi {
-					panic(fmt.Errorf("error: inconsistent XOR bit saved at %d for wheel %d", index, i))
-				}
-
-				learnedWheels[i][index%LARGE_WHEEL_SIZES[i]] = &bi
-			}
-
-		}
+	if cipherInt != 0 && cipherInt != 31 {
+		return 0, false
 	}
 
+	//All output bits were 0, so we know that EVERY plaintext bit XORed with b_{i} to 0, for all i
+	//To learn the bits b_{i}, we XOR again
+	return cipherInt ^ plainInt, true
+}
+
+//interestingCharacter returns true if the cipher integer is a permutation of "00001" or "11110",
+//so that learnEasyTransposeBits can learn from it
+func interestingCharacter(cipherInt int) bool {
+	_, present := interestingCharacters[string(BLETCHLEY_ALPHABET.Symbol(cipherInt))]
+	return present
 }
 
-//learnEasyTransposeBits learns all of the bits in wheels 5-8, and most (but not all) of the bits in wheel 9
-func learnEasyTransposeBits(wheels []*Wheel, learnedWheels [][]*int, plaintext, ciphertext string) {
+//learnEasyTransposeBits learns the bits of the transpose wheels (wheels 5-9) from a single character, if a single
+//bit is seen to move through the permutation network; for DEFAULT_NETWORK, that is all of the bits in wheels 5-8,
+//and most (but not all) of the bits in wheel 9
+//mask holds the bits of the XOR wheels (wheels 0-4) for the character, and inferenceTable is the network's InferenceTable
+//It returns the bit learned for each transpose wheel, or nil for those it says nothing about, and an
+//InconsistentBitError (for the given position of the message stream) if the XOR wheels do not agree with the ciphertext
+func learnEasyTransposeBits(inferenceTable [][][]*int, plainInt, mask, cipherInt, position int) ([]*int, error) {
 
-	//Iterate over the ciphertext. If the ciphercharacter is one of T,3,4,5,E,K,Q,6,X,V,
+	//If the ciphercharacter is one of T,3,4,5,E,K,Q,6,X,V,
 	//we XOR the plainInt with the current state of the XOR wheels (which is known)
 	//This gives a permutation of "00001" or "11110"
 	//The current cipherInt must also be a (potentially different) permutation of the same two bit sequences
-	//Based on where the unique bit (the unique 0 or unique 1) started and ended, we can deduce at least 2 transposed bits
-	for index, plainRune := range plaintext {
-		plainChar := string(plainRune)
-		if plainChar == "-" {
-			TickAll(wheels)
-			continue
-		}
-
-		plainInt := alphabet[plainChar]
-
-		cipherRune := rune(ciphertext[index])
-		cipherChar := string(cipherRune)
-
-		cipherInt := alphabet[cipherChar]
-
-		//Check if the cipherCharacter is one of the characters we care about
-		if _, present := interestingCharacters[cipherChar]; present {
-			//XOR the plainInt with the current state of the XOR wheels
-
-			xoredValue := xorCurrentCharacter(wheels, plainInt)
-
-			sourceIndex, err := FindUniqueBitIndex(xoredValue)
-			if err != nil {
-				panic(err)
-			}
-
-			destIndex, err := FindUniqueBitIndex(cipherInt)
-			if err != nil {
-				panic(err)
-			}
-
-			inferredBits := inferTransposeBits(sourceIndex, destIndex)
-			for i, bitP := range inferredBits {
-				if bitP != nil {
-					bit := *bitP
+	//Based on where the unique bit (the unique 0 or unique 1) started and ended, we can deduce some of the transposed bits
+	if !interestingCharacter(cipherInt) {
+		return nil, nil
+	}
+	xoredValue := plainInt ^ mask
 
-					//Check that we are never overwriting an existing known value with a (conflicting) known value; this should never be possible
-					//Unlike Part 2, we don't need to take the modulus because the wheel size has been set to the length of the text
-					if learnedWheels[5+i][index] != nil && *learnedWheels[5+i][index] != bit {
-						panic(fmt.Errorf("error: inconsistent transposition bit saved at %d for wheel %d", index, 5+i))
-					}
+	//The permutation preserves the number of 1s, so if this fails, the XOR wheels are wrong
+	sourceIndex, err := FindUniqueBitIndex(xoredValue)
+	if err != nil {
+		return nil, &InconsistentBitError{Wheel: -1, Position: position}
+	}
 
-					//Store the bit in the collection of learned wheels
-					learnedWheels[5+i][index] = &bit
-				}
-			}
+	destIndex, err := FindUniqueBitIndex(cipherInt)
+	if err != nil {
+		return nil, err
+	}
 
-		} else {
-			TickAll(wheels)
-		}
+	//If the network cannot move the bit there, the XOR wheels are wrong
+	inferredBits := inferenceTable[sourceIndex][destIndex]
+	if inferredBits == nil {
+		return nil, &InconsistentBitError{Wheel: -1, Position: position}
 	}
+	return inferredBits, nil
 }
 
 //learnHardTransposeBits will learn the missing transpose bits in wheel 9, assuming all of wheels 5-8 are known
@@ -568,14 +422,12 @@ func learnHardTransposeBits(wheels []*Wheel, learnedWheels [][]*int, plaintext,
 	}
 
 	for index, plainRune := range plaintext {
-		plainChar := string(plainRune)
-
-		plainInt := alphabet[plainChar]
+		plainInt, _ := BLETCHLEY_ALPHABET.Code(plainRune)
 
 		cipherRune := rune(ciphertext[index])
 		cipherChar := string(cipherRune)
 
-		cipherInt := alphabet[cipherChar]
+		cipherInt, _ := BLETCHLEY_ALPHABET.Code(cipherRune)
 
 		present := false
 
@@ -585,11 +437,11 @@ func learnHardTransposeBits(wheels []*Wheel, learnedWheels [][]*int, plaintext,
 				xoredValue := xorCurrentCharacter(wheels, plainInt)
 				sourceIndex, err := FindUniqueBitIndex(xoredValue)
 				if err != nil {
-					panic(err)
+					return &InconsistentBitError{Wheel: -1, Position: index}
 				}
 				destIndex, err := FindUniqueBitIndex(cipherInt)
 				if err != nil {
-					panic(err)
+					return err
 				}
 
 				if destIndex == 4 {
@@ -633,7 +485,7 @@ func learnHardTransposeBits(wheels []*Wheel, learnedWheels [][]*int, plaintext,
 	for wheelIndex, wheel := range learnedWheels {
 		for i, w := range wheel {
 			if w == nil {
-				return fmt.Errorf("error: wheel %d spoke %d is unknown", wheelIndex, i)
+				return &InsufficientTrafficError{Wheel: wheelIndex, Spoke: i}
 			}
 		}
 	}
@@ -644,14 +496,14 @@ func learnHardTransposeBits(wheels []*Wheel, learnedWheels [][]*int, plaintext,
 }
 
 //removePossibleWheelState will remove the impossibleSize from the list of possible sizes for wheel with index wheelIndex in the set of possible sizes
-func removePossibleWheelState(possibleSizes []map[int]struct{}, wheelIndex, impossibleSize int) []map[int]struct{} {
+//wheelCounts is the number of physical wheels of each size in the inventory
+func removePossibleWheelState(possibleSizes []map[int]struct{}, wheelCounts map[int]int, wheelIndex, impossibleSize int) []map[int]struct{} {
 
 	//Remove it from the list of possible sizes for the specified wheel iff it is present
 	if _, ok := possibleSizes[wheelIndex][impossibleSize]; ok {
 		delete(possibleSizes[wheelIndex], impossibleSize)
 
 		//If there is only one possibility left, we know this wheel with certainty
-		//Delete this size from all other wheels
 		if len(possibleSizes[wheelIndex]) == 1 {
 
 			//TODO figure out better hack
@@ -661,9 +513,21 @@ func removePossibleWheelState(possibleSizes []map[int]struct{}, wheelIndex, impo
 				break
 			}
 
+			//If that accounts for every physical wheel of this size, delete this size from all other wheels
+			determined := map[int]bool{}
+			for i, sizes := range possibleSizes {
+				if _, ok := sizes[actualSize]; ok && len(sizes) == 1 {
+					determined[i] = true
+				}
+			}
+			if len(determined) < wheelCounts[actualSize] {
+				return possibleSizes
+			}
+
 			for i, _ := range possibleSizes {
-				if i != wheelIndex {
-					possibleSizes = removePossibleWheelState(possibleSizes, i, actualSize)
+				//If there are more of these wheels than we have, this will leave one of them with no possible size
+				if i != wheelIndex && !(determined[i] && len(determined) == wheelCounts[actualSize]) {
+					possibleSizes = removePossibleWheelState(possibleSizes, wheelCounts, i, actualSize)
 				}
 			}
 		}
@@ -671,181 +535,106 @@ func removePossibleWheelState(possibleSizes []map[int]struct{}, wheelIndex, impo
 	return possibleSizes
 }
 
-// CrackMessage will read a file containing a series of encrypted messages (one per line)
-// and determine the wheel order and values from the messages
-// It assumes that plaintext messages begin with "UMUM4VEVE35"
-// and end with "35"
-// It will fail if there are not enough messages to determine wheel order fully
-func crackMessage(filename string) []*Wheel {
-	//TODO rename this
+//CrackOptions configures Crack
+type CrackOptions struct {
+	//WheelSizes is the inventory of physical wheels that may be fitted to the machine, given by their sizes
+	//There may be more than ten, and several wheels may have the same size, but the cracker
+	//can only tell wheels apart by their sizes
+	//If nil, WHEEL_SIZES is used
+	WheelSizes []int
+
+	//Cribs describe the plaintext that is known for the messages, written in Alphabet
+	//If nil, DEFAULT_CRIBS is used
+	Cribs []Crib
+
+	//ConfidenceThreshold is the probability at which CrackStatistical declares the value of a spoke
+	//If zero, DEFAULT_CONFIDENCE_THRESHOLD is used
+	ConfidenceThreshold float64
+
+	//Network is the permutation network of the machine that sent the traffic
+	//If nil, DEFAULT_NETWORK is used
+	Network PermutationNetwork
+
+	//Stepper decides how the wheels of the machine that sent the traffic turn
+	//If nil, every wheel turns once per character
+	Stepper Stepper
+
+	//Alphabet is the notation that the messages and cribs are written in
+	//If nil, BLETCHLEY_ALPHABET is used
+	Alphabet *Alphabet
+}
 
-	var learnedWheels = [][]*int{}
+//CrackResult holds the wheels recovered by Crack
+type CrackResult struct {
+	//Wheels are the ten wheels in the order they sit on the machine, reset to their starting position
+	Wheels []*Wheel
 
-	//Use the LARGE wheel sizes instead of the regular wheel sizes this time
-	for i := 0; i < 10; i++ {
-		tmp_wheel := make([]*int, LARGE_WHEEL_SIZES[i])
+	//WheelOrder gives, for each of the ten positions on the machine, the index into the
+	//inventory (CrackOptions.WheelSizes) of the physical wheel that sits there
+	WheelOrder []int
+}
 
-		learnedWheels = append(learnedWheels, tmp_wheel)
+// crackMessage will read a file containing a series of encrypted messages (one per line)
+// and determine the wheel order and values from the messages
+// It panics if the messages cannot be cracked; see Crack for a version that returns an error instead
+func crackMessage(filename string) []*Wheel {
+	f, err := os.Open(filename)
+	if err != nil {
+		panic(err)
 	}
+	defer f.Close()
 
-	ciphertext, plaintext := parseCiphertext(filename)
-
-	//Learn all bits of the first five wheels
-	//The results are stored in learnedWheels (global variable)
-	learnFirstFiveWheels(learnedWheels, plaintext, ciphertext)
-
-	POSSIBLE_SIZES := make([]map[int]struct{}, 10)
-	for i, _ := range POSSIBLE_SIZES {
-		POSSIBLE_SIZES[i] = map[int]struct{}{
-			47: {},
-			53: {},
-			59: {},
-			61: {},
-			64: {},
-			65: {},
-			67: {},
-			69: {},
-			71: {},
-			73: {},
-		}
+	result, err := Crack(f, CrackOptions{})
+	if err != nil {
+		panic(err)
 	}
+	return result.Wheels
+}
 
-	for i := 0; i < 5; i++ {
-		for size := range POSSIBLE_SIZES[i] {
-			for spokeIndex := 0; spokeIndex < size; spokeIndex++ {
-				impliedBit := -1
-				for index := spokeIndex; index < len(plaintext); index += size {
-					currentBit := learnedWheels[i][index]
-					if currentBit != nil {
-						if impliedBit == -1 {
-							impliedBit = *currentBit
-						} else if impliedBit != *currentBit {
-							//This means we have found a conflict
-							//Remove this wheel size from the pool of possible wheel sizes for this wheel
-							POSSIBLE_SIZES = removePossibleWheelState(POSSIBLE_SIZES, i, size)
-						}
-					}
-				}
-			}
-		}
+// Crack will read a series of encrypted messages (one per line)
+// and determine the wheel order and values from the messages
+// It assumes that plaintext messages contain the cribs in opts,
+// which by default means that they begin with "UMUM4VEVE35" and end with "35"
+// It returns an InsufficientTrafficError if there are not enough messages to determine wheel order fully,
+// an InconsistentBitError if the messages contradict each other,
+// and a MalformedLineError if a message cannot be parsed
+// Use CrackPartial to keep what was learned when there are not enough messages
+func Crack(r io.Reader, opts CrackOptions) (*CrackResult, error) {
+	partial, err := CrackPartial(r, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	//At this point, all of the first five wheels should be known
-	//This is not always the case, but it will be the case for the current input
-	//TODO account for the case in which the ciphertext is not long enough to learn all of the first five wheels
-
-	//Now, we know the bits of wheels 0-4, but they are in the wrong locations
-	//Set those bits to the correct locations
-	for i, _ := range POSSIBLE_SIZES[:5] {
-		//TODO figure out better hack
-		var wheelSize int
-		for k, _ := range POSSIBLE_SIZES[i] {
-			wheelSize = k
-			break
-		}
-
-		for j, _ := range learnedWheels[i] {
-			if learnedWheels[i][j] != nil {
-				learnedWheels[i][j%wheelSize] = learnedWheels[i][j]
-			}
-		}
+	wheels, err := partial.Wheels()
+	if err != nil {
+		return nil, err
 	}
 
-	//Truncate the first five wheels to their correct sizes
-	for i, _ := range learnedWheels[:5] {
-		//TODO figure out better hack
-		var wheelSize int
-		for k, _ := range POSSIBLE_SIZES[i] {
-			wheelSize = k
-			break
-		}
-		learnedWheels[i] = learnedWheels[i][:wheelSize]
+	inventory := opts.WheelSizes
+	if inventory == nil {
+		inventory = WHEEL_SIZES
 	}
+	return &CrackResult{Wheels: wheels, WheelOrder: partial.WheelOrder(inventory)}, nil
+}
 
-	//At this point, we know all the bits on the first five wheels
-	//AND they are in the correct locations
-
-	//We are ready to create Wheel structs for the first five wheels
-	wheels := make([]*Wheel, 5)
-	//Create actual Wheel structs for these fully-learned wheels and append them to "wheels" (global variable)
-	for wheelIndex, lw := range learnedWheels[:5] {
-		items := make([]int, len(lw))
-		for i, item := range lw {
-			items[i] = *item
-		}
-		wheel := NewWheel(items)
-		wheels[wheelIndex] = wheel
-	}
-
-	//Now, we need to do the same thing, but for wheels 5-9
-
-	//Learn the transpose bits, though they will not be in the correct locations
-	learnEasyTransposeBits(wheels, learnedWheels, plaintext, ciphertext)
-
-	//Figure out the actual sizes for wheels 5-9, so we can set the learned bits to be in the correct locations
-	for i := 5; i < 10; i++ {
-		for size := range POSSIBLE_SIZES[i] {
-			for spokeIndex := 0; spokeIndex < size; spokeIndex++ {
-				impliedBit := -1
-				for index := spokeIndex; index < len(plaintext); index += size {
-					currentBit := learnedWheels[i][index]
-					if currentBit != nil {
-						if impliedBit == -1 {
-							impliedBit = *currentBit
-						} else if impliedBit != *currentBit {
-							//This means we have found a conflict
-							//Remove this wheel size from the pool of possible wheel sizes for this wheel
-							POSSIBLE_SIZES = removePossibleWheelState(POSSIBLE_SIZES, i, size)
-						}
-					}
-				}
-			}
-		}
+// CrackPartial is like Crack, but it returns everything that could be learned about each wheel
+// instead of an InsufficientTrafficError
+func CrackPartial(r io.Reader, opts CrackOptions) (PartialWheels, error) {
+	if err := validateStepper(opts.Stepper); err != nil {
+		return nil, err
 	}
 
-	//At this point, all sizes for all wheels are known
+	cracker := NewIncrementalCracker(opts)
 
-	//Now, we know the bits of wheels 5-9, but they are in the wrong locations
-	//Set those bits to the correct locations
-	for i, _ := range POSSIBLE_SIZES[5:] {
-		//TODO figure out better hack
-		var wheelSize int
-		for k, _ := range POSSIBLE_SIZES[5+i] {
-			wheelSize = k
-			break
-		}
-
-		for j, _ := range learnedWheels[5+i] {
-			if learnedWheels[5+i][j] != nil {
-				learnedWheels[5+i][j%wheelSize] = learnedWheels[5+i][j]
-			}
-		}
-	}
-
-	//Truncate the first five wheels to their correct sizes
-	for i, _ := range learnedWheels[5:] {
-		//TODO figure out better hack
-		var wheelSize int
-		for k, _ := range POSSIBLE_SIZES[5+i] {
-			wheelSize = k
-			break
-		}
-		learnedWheels[5+i] = learnedWheels[5+i][:wheelSize]
+	ciphertext, plaintext, err := parseIntercepts(r, cracker.cribs, cracker.alphabet)
+	if err != nil {
+		return nil, err
 	}
 
-	//We are ready to create Wheel structs for wheels 5-9
-	//Create actual Wheel structs for these fully-learned wheels and append them to "wheels" (global variable)
-	for _, lw := range learnedWheels[5:] {
-		items := make([]int, len(lw))
-		for i, item := range lw {
-			items[i] = *item
-		}
-		wheel := NewWheel(items)
-		wheels = append(wheels, wheel)
+	if err := cracker.extend(ciphertext, plaintext); err != nil {
+		return nil, err
 	}
-
-	//TODO this is a global variable; it should eventually not be
-	return wheels
+	return cracker.partialWheels(), nil
 }
 
 //Utility function for testing only
@@ -1,8 +1,11 @@
 package geheimschreiber
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -61,7 +64,60 @@ func Test_CrackWheels(t *testing.T) {
 	//We know it starts off with UMUM4VEVE35
 	for i, wheel := range wheels {
 		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
-			t.Error("Error decoding ciphertext: wheel %d does not match expected result")
+			t.Errorf("Error decoding ciphertext: wheel %d does not match expected result", i)
+		}
+	}
+}
+
+func Test_Crack(t *testing.T) {
+
+	f, err := os.Open(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error opening file: %s", err.Error())
+	}
+	defer f.Close()
+
+	result, err := Crack(f, CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	for i, wheel := range result.Wheels {
+		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+			t.Errorf("Error decoding ciphertext: wheel %d does not match expected result", i)
+		}
+	}
+}
+
+func Test_CrackErrors(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	lines := strings.Split(string(bts), "\n")
+
+	//Fifty messages determine the size of wheel 0, but not all of its spokes
+	_, err = Crack(strings.NewReader(strings.Join(lines[:50], "\n")), CrackOptions{})
+	var insufficient *InsufficientTrafficError
+	if !errors.As(err, &insufficient) || insufficient.Wheel != 0 || insufficient.Spoke < 0 {
+		t.Errorf("Expected insufficient traffic error for a spoke of wheel 0, got %v", err)
+	}
+
+	//Replacing the start of a preamble with "2222" implies the wrong XOR bits
+	tampered := append([]string{}, lines...)
+	tampered[3] = "2222" + tampered[3][4:]
+	_, err = Crack(strings.NewReader(strings.Join(tampered, "\n")), CrackOptions{})
+	var inconsistent *InconsistentBitError
+	if !errors.As(err, &inconsistent) {
+		t.Errorf("Expected inconsistent bit error, got %v", err)
+	}
+
+	malformed := []string{"BTEVUIO7WG", "BTEVUIO7WGRIDB!FFHSK6SOW6T"}
+	for _, line := range malformed {
+		_, err = Crack(strings.NewReader(line), CrackOptions{})
+		var malformedErr *MalformedLineError
+		if !errors.As(err, &malformedErr) || malformedErr.Line != 1 {
+			t.Errorf("Expected malformed line error for %q, got %v", line, err)
 		}
 	}
 }
@@ -127,3 +183,45 @@ func Test_Encryption(t *testing.T) {
 		t.Errorf("Encrypted plaintext (length %d) does not match target ciphertext (length %d) - first error at char %d ", len(result), len(ciphertext), diff)
 	}
 }
+
+func Test_CrackWheelOrder(t *testing.T) {
+
+	inventory := [][]int{
+		//A larger inventory, in a different order
+		[]int{79, 73, 71, 69, 67, 43, 65, 64, 61, 59, 53, 47},
+		//Two wheels of size 47
+		[]int{47, 73, 71, 69, 67, 65, 64, 61, 59, 53, 47},
+	}
+
+	for _, sizes := range inventory {
+		f, err := os.Open(TEST_CIPHERTEXT_FILE)
+		if err != nil {
+			t.Fatalf("Error opening file: %s", err.Error())
+		}
+
+		result, err := Crack(f, CrackOptions{WheelSizes: sizes})
+		f.Close()
+		if err != nil {
+			t.Fatalf("Error cracking ciphertext: %s", err.Error())
+		}
+
+		used := map[int]bool{}
+		for i, wheel := range result.Wheels {
+			if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+				t.Errorf("Wheel %d does not match expected result", i)
+			}
+			if sizes[result.WheelOrder[i]] != wheel.MaxSize {
+				t.Errorf("Wheel %d has size %d, but is assigned physical wheel %d of size %d", i, wheel.MaxSize, result.WheelOrder[i], sizes[result.WheelOrder[i]])
+			}
+			if used[result.WheelOrder[i]] {
+				t.Errorf("Physical wheel %d is used twice", result.WheelOrder[i])
+			}
+			used[result.WheelOrder[i]] = true
+		}
+	}
+
+	_, err := Crack(strings.NewReader("BTEVUIO7WGRIDBEFFHSK6SOW6T"), CrackOptions{WheelSizes: []int{47, 53}})
+	if err == nil {
+		t.Errorf("Expected an error for an inventory of fewer than ten wheels")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/ChimeraCoder/geheimschreiber
+
+go 1.13
@@ -0,0 +1,513 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+//IncrementalCracker learns the wheels from messages one at a time, as they are intercepted
+//The messages must be added in the order in which they were sent, since the wheels
+//are not reset between messages
+//Each message (or crib) is learned from on its own, along with any earlier characters that could not be
+//learned from until now, so adding a message does not mean working through all of the traffic again
+type IncrementalCracker struct {
+	ciphertext []byte
+	plaintext  []byte
+	messages   int
+	cribs      []Crib
+
+	//messageStarts holds the position in the message stream at which each message starts
+	messageStarts []int
+
+	//learnedWheels holds the bit learned each time each wheel turned; unless the wheels turn irregularly,
+	//that is once per position of the message stream
+	learnedWheels [][]*int
+	possibleSizes []map[int]struct{}
+
+	//overlays holds, for each wheel and each size that it may still have, the learned bits overlaid onto a
+	//wheel of that size, so that each new bit can be checked against every possible size at once
+	overlays []map[int][]*int
+
+	//positions holds how far each wheel had turned at each position of the message stream (see streamPositions),
+	//or nil if the wheels turn regularly
+	//turned is how far each wheel had turned at the end of the stream
+	positions [][]int
+	turned    [10]int
+
+	//waiting holds the positions of the message stream that could not be learned from yet, by what they are
+	//waiting for; a negative position -(p+1) means that the positions of the wheels should be worked out
+	//again from position p, where a wheel's position was lost
+	//queue holds the positions that should be learned from again, now that what they were waiting for is known
+	waiting map[waitingFor]map[int]struct{}
+	queue   []int
+
+	//inventory holds the size of each physical wheel, and wheelCounts the number of physical wheels of each size
+	inventory   []int
+	wheelCounts map[int]int
+
+	network        PermutationNetwork
+	inferenceTable [][][]*int
+	stepper        Stepper
+	alphabet       *Alphabet
+}
+
+//waitingFor is something that must be known before a position of the message stream can be learned from:
+//the size of a wheel (size 0, spoke -1), how far the wheel had turned (size -1, spoke -1), one of the spokes
+//of a wheel of the given size, or (size 0) the bit that the wheel read the spoke-th time it turned
+type waitingFor struct {
+	wheel, size, spoke int
+}
+
+//CrackStatus reports how much an IncrementalCracker has learned so far
+type CrackStatus struct {
+	//Messages is the number of messages that have been added
+	Messages int
+
+	//Wheels holds everything that has been learned about each wheel
+	Wheels PartialWheels
+
+	//Solved is true once every spoke of every wheel is known
+	Solved bool
+
+	//WheelOrder gives, for each of the ten positions on the machine, the index into the
+	//inventory of the physical wheel that sits there, or -1 if it is not yet known
+	WheelOrder []int
+}
+
+func NewIncrementalCracker(opts CrackOptions) *IncrementalCracker {
+	c := new(IncrementalCracker)
+
+	c.inventory = opts.WheelSizes
+	if c.inventory == nil {
+		c.inventory = WHEEL_SIZES
+	}
+	c.wheelCounts = map[int]int{}
+	for _, size := range c.inventory {
+		c.wheelCounts[size]++
+	}
+
+	c.network = opts.Network.orDefault()
+	c.stepper = opts.Stepper
+	c.alphabet = opts.Alphabet.orDefault()
+
+	c.cribs = opts.Cribs
+	if c.cribs == nil {
+		c.cribs = defaultCribs(c.alphabet)
+	}
+
+	c.reset()
+	return c
+}
+
+//AddMessage adds a single intercepted message and learns whatever it can from it
+//If the message is malformed, the MalformedLineError reports the number of the message
+//(counting from 1) as its line
+//If an error is returned, the cracker is left unchanged, so the message can simply be discarded
+func (c *IncrementalCracker) AddMessage(ciphertext string) error {
+	if err := validateStepper(c.stepper); err != nil {
+		return err
+	}
+	ciphertext = strings.TrimRight(ciphertext, "\r\n")
+
+	messageCiphertext, messagePlaintext, err := parseMessage(ciphertext, c.cribs, c.messages+1, c.messages+1, c.alphabet)
+	if err != nil {
+		return err
+	}
+
+	start := len(c.plaintext)
+	if err := c.extend(messageCiphertext, messagePlaintext); err != nil {
+		c.relearn(start)
+		return err
+	}
+	c.messageStarts = append(c.messageStarts, start)
+	c.messages++
+	return nil
+}
+
+//AddCrib adds a crib (such as one accepted from DragCrib) and learns whatever it can from it
+//The crib is applied to the messages that have already been added, and to any that are added later
+//If an error is returned, the cracker is left unchanged
+func (c *IncrementalCracker) AddCrib(crib Crib) error {
+
+	//Work out which characters the crib tells us, before changing anything
+	changed := map[int]byte{}
+	for i, start := range c.messageStarts {
+		if crib.Message != 0 && crib.Message != i+1 {
+			continue
+		}
+		end := len(c.plaintext)
+		if i+1 < len(c.messageStarts) {
+			end = c.messageStarts[i+1]
+		}
+		message := append([]byte{}, c.plaintext[start:end]...)
+		if err := applyCrib(message, crib, i+1, c.alphabet); err != nil {
+			return err
+		}
+		for j, character := range message {
+			if character != c.plaintext[start+j] {
+				changed[start+j] = character
+			}
+		}
+	}
+
+	previous := map[int]byte{}
+	for position, character := range changed {
+		previous[position] = c.plaintext[position]
+		c.plaintext[position] = character
+		c.queue = append(c.queue, position)
+	}
+	if err := c.settle(); err != nil {
+		for position, character := range previous {
+			c.plaintext[position] = character
+		}
+		c.relearn(len(c.plaintext))
+		return err
+	}
+	c.cribs = append(append([]Crib{}, c.cribs...), crib)
+	return nil
+}
+
+//Status reports what has been learned so far
+func (c *IncrementalCracker) Status() CrackStatus {
+	wheels := c.partialWheels()
+	return CrackStatus{
+		Messages:   c.messages,
+		Wheels:     wheels,
+		Solved:     wheels.Complete(),
+		WheelOrder: wheels.WheelOrder(c.inventory),
+	}
+}
+
+//reset forgets the message stream, and everything learned from it
+func (c *IncrementalCracker) reset() {
+	c.ciphertext, c.plaintext = nil, nil
+	c.learnedWheels = make([][]*int, 10)
+	c.possibleSizes = make([]map[int]struct{}, 10)
+	c.overlays = make([]map[int][]*int, 10)
+	for i := range c.possibleSizes {
+		c.possibleSizes[i] = map[int]struct{}{}
+		c.overlays[i] = map[int][]*int{}
+		for size := range c.wheelCounts {
+			c.possibleSizes[i][size] = struct{}{}
+			c.overlays[i][size] = make([]*int, size)
+		}
+	}
+
+	c.positions = nil
+	if _, regular := c.stepper.(RegularStepper); c.stepper != nil && !regular {
+		c.positions = make([][]int, 10)
+	}
+	c.turned = [10]int{}
+	c.waiting = map[waitingFor]map[int]struct{}{}
+	c.queue = nil
+}
+
+//relearn forgets everything that has been learned, and learns from the first length characters of the message
+//stream again; it is used to undo a change that failed, since those characters were learned from without error
+func (c *IncrementalCracker) relearn(length int) {
+	ciphertext, plaintext := string(c.ciphertext[:length]), string(c.plaintext[:length])
+	c.reset()
+	c.extend(ciphertext, plaintext)
+}
+
+//extend appends the ciphertext and plaintext (both in BLETCHLEY_ALPHABET) to the message stream, and learns
+//as much as possible from them
+func (c *IncrementalCracker) extend(ciphertext, plaintext string) error {
+	if len(c.inventory) < 10 {
+		return errors.New("error: the inventory must have at least ten wheels")
+	}
+	if err := c.network.Validate(); err != nil {
+		return err
+	}
+	if c.inferenceTable == nil {
+		c.inferenceTable = c.network.InferenceTable()
+	}
+
+	start := len(c.plaintext)
+	c.ciphertext = append(c.ciphertext, ciphertext...)
+	c.plaintext = append(c.plaintext, plaintext...)
+
+	//Every position in the message stream gets its own spoke until we know the wheel sizes
+	for i, lw := range c.learnedWheels {
+		c.learnedWheels[i] = append(lw, make([]*int, len(plaintext))...)
+	}
+	if c.positions != nil {
+		for i, wheelPositions := range c.positions {
+			c.positions[i] = append(wheelPositions, make([]int, len(plaintext))...)
+		}
+		c.walk(start, c.turned)
+	}
+
+	for p := start; p < len(c.plaintext); p++ {
+		c.queue = append(c.queue, p)
+	}
+	return c.settle()
+}
+
+//settle learns from every position in the queue, and from the positions that were waiting for what that teaches us,
+//until there is nothing more to learn
+//Determining the size of a transpose wheel can determine the size of an XOR wheel by exclusion,
+//which tells us more XOR bits, which lets us learn more transpose bits
+//If the wheels turn irregularly, learning more bits can also tell us where more of the wheels were
+func (c *IncrementalCracker) settle() error {
+	rewalkFrom := -1
+	for len(c.queue) > 0 || rewalkFrom >= 0 {
+		if len(c.queue) == 0 {
+			var turned [10]int
+			for i := range turned {
+				turned[i] = c.positions[i][rewalkFrom]
+			}
+			c.walk(rewalkFrom, turned)
+			rewalkFrom = -1
+			for i := range c.positions {
+				c.wake(waitingFor{i, -1, -1})
+			}
+			continue
+		}
+
+		p := c.queue[len(c.queue)-1]
+		c.queue = c.queue[:len(c.queue)-1]
+		if p < 0 {
+			if from := -p - 1; rewalkFrom < 0 || from < rewalkFrom {
+				rewalkFrom = from
+			}
+			continue
+		}
+		if err := c.learnPosition(p); err != nil {
+			c.queue = nil
+			return err
+		}
+	}
+	return nil
+}
+
+//learnPosition learns whatever it can from the character at a single position of the message stream
+//If that depends on something that is not yet known, the position waits until it is
+func (c *IncrementalCracker) learnPosition(p int) error {
+	if c.plaintext[p] == '-' {
+		return nil
+	}
+	plainInt, _ := BLETCHLEY_ALPHABET.Code(rune(c.plaintext[p]))
+	cipherInt, _ := BLETCHLEY_ALPHABET.Code(rune(c.ciphertext[p]))
+
+	//Learn the bits of the first five wheels
+	if mask, ok := learnFirstFiveWheels(plainInt, cipherInt); ok {
+		for i := 0; i < 5; i++ {
+			if err := c.learnBit(i, p, getNthBit(mask, 4-i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !interestingCharacter(cipherInt) {
+		return nil
+	}
+
+	//The transpose bits can only be learned once the bits of the XOR wheels are known here
+	mask := 0
+	for i := 0; i < 5; i++ {
+		bit, missing := c.bit(i, p)
+		if bit == nil {
+			for _, w := range missing {
+				c.wait(w, p)
+			}
+			return nil
+		}
+		mask = mask | *bit<<(4-uint(i))
+	}
+
+	inferredBits, err := learnEasyTransposeBits(c.inferenceTable, plainInt, mask, cipherInt, p)
+	if err != nil {
+		return err
+	}
+	for i, bitP := range inferredBits {
+		if bitP != nil {
+			if err := c.learnBit(5+i, p, *bitP); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//learnBit records the bit that wheel i read at position p of the message stream, rules out every size of the wheel
+//that would put it on the same spoke as a different bit, and wakes the positions that were waiting for it
+//It returns an InconsistentBitError if the bit contradicts what is already known
+func (c *IncrementalCracker) learnBit(i, p, bit int) error {
+	turned := streamStep(c.positions, i, p)
+	if turned < 0 || turned >= len(c.learnedWheels[i]) {
+		c.wait(waitingFor{i, -1, -1}, p)
+		return nil
+	}
+	if known := c.learnedWheels[i][turned]; known != nil {
+		if *known != bit {
+			return &InconsistentBitError{Wheel: i, Position: p}
+		}
+		return nil
+	}
+
+	c.learnedWheels[i][turned] = &bit
+	c.wake(waitingFor{i, 0, turned})
+	for size, overlay := range c.overlays[i] {
+		spoke := turned % size
+		switch {
+		case overlay[spoke] == nil:
+			overlay[spoke] = &bit
+			c.wake(waitingFor{i, size, spoke})
+		case *overlay[spoke] != bit:
+			c.possibleSizes = removePossibleWheelState(c.possibleSizes, c.wheelCounts, i, size)
+		}
+	}
+	return c.updateSizes()
+}
+
+//updateSizes drops the overlays for sizes that have been ruled out, and wakes the positions that were waiting
+//for the size of a wheel once it is known
+//It returns an InconsistentBitError if no size is possible for a wheel
+func (c *IncrementalCracker) updateSizes() error {
+	for i, sizes := range c.possibleSizes {
+		if len(sizes) == 0 {
+			return &InconsistentBitError{Wheel: i, Position: -1}
+		}
+		if len(sizes) == len(c.overlays[i]) {
+			continue
+		}
+		for size := range c.overlays[i] {
+			if _, ok := sizes[size]; !ok {
+				delete(c.overlays[i], size)
+			}
+		}
+		if len(sizes) == 1 {
+			c.wake(waitingFor{i, 0, -1})
+		}
+	}
+	return nil
+}
+
+//wait makes position p wait for w; a position waiting for several things is only queued once per wake
+func (c *IncrementalCracker) wait(w waitingFor, p int) {
+	if c.waiting[w] == nil {
+		c.waiting[w] = map[int]struct{}{}
+	}
+	c.waiting[w][p] = struct{}{}
+}
+
+//wake queues the positions that were waiting for w
+func (c *IncrementalCracker) wake(w waitingFor) {
+	for p := range c.waiting[w] {
+		c.queue = append(c.queue, p)
+	}
+	delete(c.waiting, w)
+}
+
+//size returns the size of wheel i, or 0 if it has not been determined
+func (c *IncrementalCracker) size(i int) int {
+	if len(c.possibleSizes[i]) != 1 {
+		return 0
+	}
+	for size := range c.possibleSizes[i] {
+		return size
+	}
+	return 0
+}
+
+//bit returns the bit that wheel i read at position p of the message stream
+//If it is unknown, it returns nil, and what would have to be known to find it
+func (c *IncrementalCracker) bit(i, p int) (*int, []waitingFor) {
+	turned := streamStep(c.positions, i, p)
+	if turned < 0 {
+		return nil, []waitingFor{{i, -1, -1}}
+	}
+	return c.spokeBit(i, turned)
+}
+
+//spokeBit returns the bit that wheel i read once it had turned the given number of times
+//If it is unknown, it returns nil, and what would have to be known to find it
+func (c *IncrementalCracker) spokeBit(i, turned int) (*int, []waitingFor) {
+	if size := c.size(i); size != 0 {
+		if bit := c.overlays[i][size][turned%size]; bit != nil {
+			return bit, nil
+		}
+		return nil, []waitingFor{{i, size, turned % size}}
+	}
+	if turned < len(c.learnedWheels[i]) && c.learnedWheels[i][turned] != nil {
+		return c.learnedWheels[i][turned], nil
+	}
+	return nil, []waitingFor{{i, 0, -1}, {i, 0, turned}}
+}
+
+//walk works out how far each wheel had turned at each position of the message stream from position from onwards,
+//as streamPositions does, given how far they had turned there
+//Where a wheel's position is lost, the walk waits for the bits that it could not read, so that it can be
+//walked again from there once one of them is known
+func (c *IncrementalCracker) walk(from int, turned [10]int) {
+	for p := from; p < len(c.plaintext); p++ {
+		var bits [10]*int
+		for i := range turned {
+			c.positions[i][p] = turned[i]
+			if turned[i] >= 0 {
+				bits[i], _ = c.spokeBit(i, turned[i])
+			}
+		}
+
+		steps := c.stepper.Steps(bits)
+		for i := range turned {
+			if turned[i] >= 0 && steps[i] < 0 {
+				c.waitForBits(p, bits, turned)
+				break
+			}
+		}
+		for i := range turned {
+			if turned[i] < 0 || steps[i] < 0 {
+				turned[i] = -1
+			} else {
+				turned[i] += steps[i]
+			}
+		}
+	}
+	c.turned = turned
+}
+
+//waitForBits makes the walk from position p wait for every bit that could not be read there, from the wheels
+//whose positions are known
+func (c *IncrementalCracker) waitForBits(p int, bits [10]*int, turned [10]int) {
+	for j, bit := range bits {
+		if bit == nil && turned[j] >= 0 {
+			_, missing := c.spokeBit(j, turned[j])
+			for _, w := range missing {
+				c.wait(w, -p-1)
+			}
+		}
+	}
+}
+
+//partialWheels returns everything that has been learned about each wheel so far
+func (c *IncrementalCracker) partialWheels() PartialWheels {
+	wheels := make(PartialWheels, len(c.learnedWheels))
+	for i := range wheels {
+		w := new(PartialWheel)
+		for size := range c.possibleSizes[i] {
+			w.CandidateSizes = append(w.CandidateSizes, size)
+		}
+		sort.Ints(w.CandidateSizes)
+
+		if w.Size = c.size(i); w.Size != 0 {
+			w.Spokes = append([]*int{}, c.overlays[i][w.Size]...)
+		} else {
+			//We don't know where the bits belong yet, so keep them where they were learned
+			w.Spokes = append([]*int{}, c.learnedWheels[i]...)
+		}
+		wheels[i] = w
+	}
+
+	if c.positions != nil {
+		positions := make([][]int, len(c.positions))
+		for i, wheelPositions := range c.positions {
+			positions[i] = append([]int{}, wheelPositions...)
+		}
+		wheels.setPositions(positions)
+	}
+	wheels.setMachine(c.network, c.alphabet)
+	return wheels
+}
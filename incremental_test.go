@@ -0,0 +1,177 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_IncrementalCracker(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(string(bts)), "\n")
+
+	cracker := NewIncrementalCracker(CrackOptions{})
+	solvedAfter := -1
+	for i, line := range lines {
+		if err := cracker.AddMessage(line); err != nil {
+			t.Fatalf("Error adding message %d: %s", i, err.Error())
+		}
+		if cracker.Status().Solved {
+			solvedAfter = i + 1
+			break
+		}
+	}
+	if solvedAfter == -1 {
+		t.Fatalf("Expected the wheels to be solved after %d messages", len(lines))
+	}
+	if solvedAfter <= 400 {
+		t.Errorf("Wheels were solved after only %d messages", solvedAfter)
+	}
+
+	status := cracker.Status()
+	if status.Messages != solvedAfter {
+		t.Errorf("Status reports %d messages, expected %d", status.Messages, solvedAfter)
+	}
+	wheels, err := status.Wheels.Wheels()
+	if err != nil {
+		t.Fatalf("Error converting wheels: %s", err.Error())
+	}
+	for i, wheel := range wheels {
+		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+			t.Errorf("Wheel %d does not match expected result", i)
+		}
+	}
+}
+
+func Test_IncrementalCrackerRejectsMessage(t *testing.T) {
+
+	cracker := NewIncrementalCracker(CrackOptions{})
+	if err := cracker.AddMessage("BTEVUIO7WGRIDBEFFHSK6SOW6T"); err != nil {
+		t.Fatalf("Error adding message: %s", err.Error())
+	}
+
+	err := cracker.AddMessage("BTEV")
+	var malformed *MalformedLineError
+	if !errors.As(err, &malformed) || malformed.Line != 2 {
+		t.Errorf("Expected malformed line error for message 2, got %v", err)
+	}
+	if cracker.Status().Messages != 1 {
+		t.Errorf("Rejected message was counted")
+	}
+}
+
+//samePartialWheels checks that two sets of partial wheels hold the same knowledge
+func samePartialWheels(t *testing.T, got, expected PartialWheels, context string) {
+	for i := range expected {
+		if got[i].Size != expected[i].Size || len(got[i].CandidateSizes) != len(expected[i].CandidateSizes) || len(got[i].Spokes) != len(expected[i].Spokes) {
+			t.Errorf("%s: wheel %d has size %d of %v, expected %d of %v", context, i, got[i].Size, got[i].CandidateSizes, expected[i].Size, expected[i].CandidateSizes)
+			continue
+		}
+		for j, spoke := range expected[i].Spokes {
+			if (spoke == nil) != (got[i].Spokes[j] == nil) || (spoke != nil && *spoke != *got[i].Spokes[j]) {
+				t.Errorf("%s: wheel %d spoke %d differs", context, i, j)
+				break
+			}
+		}
+	}
+}
+
+func Test_IncrementalMatchesCrackPartial(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+
+	//Learning from the messages one at a time must learn exactly what learning from all of them at once does,
+	//including when the wheels turn irregularly
+	for _, stepper := range []Stepper{nil, T52D_STEPPER} {
+		m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+		if err != nil {
+			t.Fatalf("Error creating machine: %s", err.Error())
+		}
+		m.Stepper = stepper
+		m.Reset()
+		ciphertext, err := m.Encrypt(strings.TrimSpace(string(bts)))
+		m.Reset()
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		lines := strings.Split(ciphertext, "\n")
+
+		cracker := NewIncrementalCracker(CrackOptions{Stepper: stepper})
+		for i, line := range lines {
+			if err := cracker.AddMessage(line); err != nil {
+				t.Fatalf("Error adding message %d: %s", i, err.Error())
+			}
+			if i+1 == 100 || i+1 == 300 || i+1 == len(lines) {
+				partial, err := CrackPartial(strings.NewReader(strings.Join(lines[:i+1], "\n")), CrackOptions{Stepper: stepper})
+				if err != nil {
+					t.Fatalf("Error cracking ciphertext: %s", err.Error())
+				}
+				samePartialWheels(t, cracker.Status().Wheels, partial, fmt.Sprintf("after %d messages", i+1))
+			}
+		}
+	}
+}
+
+func Test_IncrementalCrackerRollsBack(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(string(bts)), "\n")
+
+	cracker := NewIncrementalCracker(CrackOptions{})
+	for _, line := range lines[:300] {
+		if err := cracker.AddMessage(line); err != nil {
+			t.Fatalf("Error adding message: %s", err.Error())
+		}
+	}
+	before := cracker.Status()
+
+	//Garble the preamble of the next message until the cracker notices
+	rejected := false
+	for i := 0; i < 11 && !rejected; i++ {
+		for _, garbled := range []string{"2", "7"} {
+			if lines[300][i:i+1] == garbled {
+				continue
+			}
+			var inconsistent *InconsistentBitError
+			if err := cracker.AddMessage(lines[300][:i] + garbled + lines[300][i+1:]); err != nil {
+				if !errors.As(err, &inconsistent) {
+					t.Fatalf("Expected an inconsistent bit error, got %v", err)
+				}
+				rejected = true
+				break
+			}
+			cracker = NewIncrementalCracker(CrackOptions{})
+			for _, line := range lines[:300] {
+				cracker.AddMessage(line)
+			}
+		}
+	}
+	if !rejected {
+		t.Fatalf("Expected a garbled message to be rejected")
+	}
+	if cracker.Status().Messages != before.Messages {
+		t.Errorf("Rejected message was counted")
+	}
+	samePartialWheels(t, cracker.Status().Wheels, before.Wheels, "after a rejected message")
+
+	for _, line := range lines[300:] {
+		if err := cracker.AddMessage(line); err != nil {
+			t.Fatalf("Error adding message: %s", err.Error())
+		}
+	}
+	if !cracker.Status().Solved {
+		t.Errorf("Expected the wheels to be solved after a rejected message")
+	}
+}
@@ -0,0 +1,139 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//The control characters of the ITA2 (Baudot-Murray) code in BLETCHLEY_ALPHABET
+const (
+	ITA2_NULL          = "2"
+	ITA2_LINE_FEED     = "3"
+	ITA2_SPACE         = "4"
+	ITA2_CARRIAGE      = "5"
+	ITA2_FIGURES_SHIFT = "6"
+	ITA2_LETTERS_SHIFT = "7"
+)
+
+//ita2Figures maps each letter to the character it prints after a figures shift
+//D (who are you), F, G and H print nothing on an international machine
+var ita2Figures = map[string]string{
+	"A": "-",
+	"B": "?",
+	"C": ":",
+	"E": "3",
+	"I": "8",
+	"J": "\a",
+	"K": "(",
+	"L": ")",
+	"M": ".",
+	"N": ",",
+	"O": "9",
+	"P": "0",
+	"Q": "1",
+	"R": "4",
+	"S": "'",
+	"T": "5",
+	"U": "7",
+	"V": "=",
+	"W": "2",
+	"X": "/",
+	"Y": "6",
+	"Z": "+",
+}
+
+//ita2FigureLetters is the inverse of ita2Figures
+var ita2FigureLetters = func() map[string]string {
+	letters := map[string]string{}
+	for letter, figure := range ita2Figures {
+		letters[figure] = letter
+	}
+	return letters
+}()
+
+//EncodeITA2 writes natural text in BLETCHLEY_ALPHABET, so that it can be encrypted
+//Spaces, carriage returns and line feeds become their control characters, and a figures or letters shift is put
+//in whenever the text changes between letters and figures (digits and punctuation). The receiving teleprinter
+//is assumed to start in letters
+//ITA2 has no lower case, so letters are written in upper case
+func EncodeITA2(text string) (string, error) {
+	var result strings.Builder
+	figures := false
+	for _, character := range text {
+		char := string(unicode.ToUpper(character))
+		switch {
+		case char == " ":
+			result.WriteString(ITA2_SPACE)
+		case char == "\r":
+			result.WriteString(ITA2_CARRIAGE)
+		case char == "\n":
+			result.WriteString(ITA2_LINE_FEED)
+		case char >= "A" && char <= "Z":
+			if figures {
+				result.WriteString(ITA2_LETTERS_SHIFT)
+				figures = false
+			}
+			result.WriteString(char)
+		default:
+			letter, ok := ita2FigureLetters[char]
+			if !ok {
+				return "", fmt.Errorf("error: character %q cannot be written in ITA2", character)
+			}
+			if !figures {
+				result.WriteString(ITA2_FIGURES_SHIFT)
+				figures = true
+			}
+			result.WriteString(letter)
+		}
+	}
+	return result.String(), nil
+}
+
+//DecodeITA2 reads text in BLETCHLEY_ALPHABET as a teleprinter would print it, starting in letters
+//Shifts and nulls print nothing. Line breaks in the notation itself (which separate messages) are passed through unchanged
+//It returns an error for a character that is not in BLETCHLEY_ALPHABET, or a figure that prints nothing
+func DecodeITA2(symbols string) (string, error) {
+	var result strings.Builder
+	figures := false
+	for _, character := range symbols {
+		char := string(character)
+		switch char {
+		case "\n", "\r":
+			result.WriteString(char)
+			continue
+		case ITA2_NULL:
+			continue
+		case ITA2_LINE_FEED:
+			result.WriteString("\n")
+			continue
+		case ITA2_SPACE:
+			result.WriteString(" ")
+			continue
+		case ITA2_CARRIAGE:
+			result.WriteString("\r")
+			continue
+		case ITA2_FIGURES_SHIFT:
+			figures = true
+			continue
+		case ITA2_LETTERS_SHIFT:
+			figures = false
+			continue
+		}
+
+		if _, ok := BLETCHLEY_ALPHABET.Code(character); !ok {
+			return "", errors.New("error: character not in alphabet")
+		}
+		if !figures {
+			result.WriteString(char)
+			continue
+		}
+		figure, ok := ita2Figures[char]
+		if !ok {
+			return "", fmt.Errorf("error: %s prints nothing after a figures shift", char)
+		}
+		result.WriteString(figure)
+	}
+	return result.String(), nil
+}
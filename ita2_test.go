@@ -0,0 +1,72 @@
+package geheimschreiber
+
+import (
+	"testing"
+)
+
+func Test_ITA2(t *testing.T) {
+
+	for _, c := range []struct {
+		text    string
+		symbols string
+	}{
+		{"King Henry IV", "KING4HENRY4IV"},
+		{"Part 1 (1597).", "PART46Q4KQTOULM"},
+		{"So shaken as we are,\r\nSo wan with care", "SO4SHAKEN4AS4WE4ARE6N537SO4WAN4WITH4CARE"},
+		{"14:30 GMT", "6QRCEP47GMT"},
+	} {
+		symbols, err := EncodeITA2(c.text)
+		if err != nil {
+			t.Fatalf("Error encoding %q: %s", c.text, err.Error())
+		}
+		if symbols != c.symbols {
+			t.Errorf("Encoded %q as %q, expected %q", c.text, symbols, c.symbols)
+		}
+	}
+
+	text := "1941: So shaken as we are, so wan with care?\r\nFind we a time (for frighted peace) to pant - 2 + 2 = 4."
+	symbols, err := EncodeITA2(text)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err.Error())
+	}
+
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+	ciphertext, err := m.Encrypt(symbols)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	m.Reset()
+	decrypted, err := m.Decrypt(ciphertext)
+	m.Reset()
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+
+	decoded, err := DecodeITA2(decrypted)
+	if err != nil {
+		t.Fatalf("Error decoding: %s", err.Error())
+	}
+	if expected := "1941: SO SHAKEN AS WE ARE, SO WAN WITH CARE?\r\nFIND WE A TIME (FOR FRIGHTED PEACE) TO PANT - 2 + 2 = 4."; decoded != expected {
+		t.Errorf("Decoded %q, expected %q", decoded, expected)
+	}
+
+	//Nulls print nothing, and line breaks between messages are kept
+	decoded, err = DecodeITA2("KING24HENRY\nIV")
+	if err != nil || decoded != "KING HENRY\nIV" {
+		t.Errorf("Decoded %q, expected %q", decoded, "KING HENRY\nIV")
+	}
+
+	if _, err := EncodeITA2("Café"); err == nil {
+		t.Errorf("Expected an error encoding a character that is not in ITA2")
+	}
+	if _, err := DecodeITA2("6D"); err == nil {
+		t.Errorf("Expected an error decoding a figure that prints nothing")
+	}
+	if _, err := DecodeITA2("KING!"); err == nil {
+		t.Errorf("Expected an error decoding a character that is not in alphabet")
+	}
+}
@@ -0,0 +1,295 @@
+package geheimschreiber
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//Key is everything needed to set up a Geheimschreiber: the variant of machine, and the pins and start position of
+//the wheel in each position
+//It can be saved as JSON (with encoding/json) or as a pin sheet (see WritePinSheet), so that keys can be shared
+type Key struct {
+	//Variant is the model of machine, which must be one of the presets in VARIANTS
+	//If nil, T52AB is used
+	Variant *Variant
+
+	//Wheels are the ten wheels in the order they sit on the machine, each starting at its CurrentIndex
+	Wheels []*Wheel
+
+	//WheelOrder gives, for each position, the index into Variant.WheelSizes of the physical wheel that
+	//sits there, as in CrackResult.WheelOrder; it may be nil, but otherwise must list each wheel once
+	WheelOrder []int
+}
+
+//pinCharacters are the characters that can be used for a pin that is not set (a 0) or set (a 1);
+//the first of each is used when writing one
+var pinCharacters = [2]string{".•", "xX×"}
+
+//Machine creates a Machine of the key's variant from its wheels, which start where the key says
+func (k *Key) Machine() (*Machine, error) {
+	return NewVariantMachine(k.variant(), k.Wheels)
+}
+
+func (k *Key) variant() *Variant {
+	if k.Variant == nil {
+		return T52AB
+	}
+	return k.Variant
+}
+
+//validate checks that the key's variant can be saved by name, that its wheels fit the variant, and that
+//its wheel order (if any) fits each wheel of the variant in exactly one position, where a wheel of its size sits
+func (k *Key) validate() error {
+	if v, ok := VARIANTS[k.variant().Name]; !ok || v != k.variant() {
+		return fmt.Errorf("error: variant %s is not in VARIANTS, so it cannot be saved by name", k.variant().Name)
+	}
+	if _, err := k.Machine(); err != nil {
+		return err
+	}
+	if k.WheelOrder == nil {
+		return nil
+	}
+
+	sizes := k.variant().WheelSizes
+	if len(k.WheelOrder) != len(k.Wheels) {
+		return &InvalidWheelError{Wheel: -1, Reason: fmt.Sprintf("wheel order has %d positions, expected %d", len(k.WheelOrder), len(k.Wheels))}
+	}
+	fitted := make([]bool, len(sizes))
+	for i, index := range k.WheelOrder {
+		if index < 0 || index >= len(sizes) {
+			return &InvalidWheelError{Wheel: i, Reason: fmt.Sprintf("wheel order puts wheel %d here, but there are only %d wheels", index, len(sizes))}
+		}
+		if fitted[index] {
+			return &InvalidWheelError{Wheel: i, Reason: fmt.Sprintf("wheel order puts wheel %d in more than one position", index)}
+		}
+		if k.Wheels[i].MaxSize != sizes[index] {
+			return &InvalidWheelError{Wheel: i, Reason: fmt.Sprintf("wheel order puts wheel %d here, which has %d spokes, but this wheel has %d", index, sizes[index], k.Wheels[i].MaxSize)}
+		}
+		fitted[index] = true
+	}
+	return nil
+}
+
+type keyJSON struct {
+	Variant    string      `json:"variant"`
+	WheelOrder []int       `json:"wheel_order,omitempty"`
+	Wheels     []wheelJSON `json:"wheels"`
+}
+
+type wheelJSON struct {
+	Pins  string `json:"pins"`
+	Start int    `json:"start"`
+}
+
+//MarshalJSON writes the key with its variant by name, and the pins of each wheel in x/. notation
+func (k *Key) MarshalJSON() ([]byte, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	saved := keyJSON{Variant: k.variant().Name, WheelOrder: k.WheelOrder}
+	for _, w := range k.Wheels {
+		saved.Wheels = append(saved.Wheels, wheelJSON{Pins: pinString(w, 0), Start: w.CurrentIndex})
+	}
+	return json.Marshal(saved)
+}
+
+//UnmarshalJSON reads a key written by MarshalJSON
+//It returns an error if the variant is not in VARIANTS, or the wheels do not fit it
+func (k *Key) UnmarshalJSON(data []byte) error {
+	var saved keyJSON
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	v, err := VariantByName(saved.Variant)
+	if err != nil {
+		return err
+	}
+
+	loaded := Key{Variant: v, WheelOrder: saved.WheelOrder}
+	for i, wheel := range saved.Wheels {
+		items, err := parsePins(wheel.Pins)
+		if err != nil {
+			return &InvalidWheelError{Wheel: i, Reason: err.Error()}
+		}
+		w := NewWheel(items)
+		w.CurrentIndex = wheel.Start
+		loaded.Wheels = append(loaded.Wheels, w)
+	}
+	if err := loaded.validate(); err != nil {
+		return err
+	}
+	*k = loaded
+	return nil
+}
+
+//WritePinSheet writes the key as a pin sheet that an analyst can read and correct by hand:
+//
+//	variant T52a/b
+//	order 0 1 2 3 4 5 6 7 8 9
+//
+//	wheel 0 size 47 start 12
+//	x..xx .x.x. ...
+//
+//Each wheel's pins are written in groups of five, fifty to a line, with x for a 1 and . for a 0
+//The order line is only written if the key has a WheelOrder
+func WritePinSheet(w io.Writer, k *Key) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+
+	var sheet strings.Builder
+	fmt.Fprintf(&sheet, "variant %s\n", k.variant().Name)
+	if k.WheelOrder != nil {
+		sheet.WriteString("order")
+		for _, index := range k.WheelOrder {
+			fmt.Fprintf(&sheet, " %d", index)
+		}
+		sheet.WriteString("\n")
+	}
+	for i, wheel := range k.Wheels {
+		fmt.Fprintf(&sheet, "\nwheel %d size %d start %d\n", i, wheel.MaxSize, wheel.CurrentIndex)
+		for start := 0; start < wheel.MaxSize; start += 50 {
+			end := start + 50
+			if end > wheel.MaxSize {
+				end = wheel.MaxSize
+			}
+			sheet.WriteString(pinString(&Wheel{Items: wheel.Items[start:end]}, 5))
+			sheet.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, sheet.String())
+	return err
+}
+
+//ReadPinSheet reads a key written by WritePinSheet
+//Blank lines, and anything after a #, are ignored, as are spaces between pins; pins may also be written
+//as • and × (or X)
+//It returns a MalformedLineError if a line cannot be read, and an error if the wheels do not fit the variant
+func ReadPinSheet(r io.Reader) (*Key, error) {
+	k := &Key{Wheels: make([]*Wheel, 10)}
+	var current *Wheel
+	lineNumber := 0
+	malformed := func(reason string, args ...interface{}) error {
+		return &MalformedLineError{Line: lineNumber, Reason: fmt.Sprintf(reason, args...)}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "variant":
+			v, err := VariantByName(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "variant")))
+			if err != nil {
+				return nil, malformed("%s", err.Error())
+			}
+			k.Variant = v
+
+		case "order":
+			k.WheelOrder = []int{}
+			for _, field := range fields[1:] {
+				index, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, malformed("wheel order %q is not a number", field)
+				}
+				k.WheelOrder = append(k.WheelOrder, index)
+			}
+
+		case "wheel":
+			numbers := make([]int, 3)
+			if len(fields) != 6 || fields[2] != "size" || fields[4] != "start" {
+				return nil, malformed("expected \"wheel <position> size <size> start <start>\"")
+			}
+			for i, field := range []string{fields[1], fields[3], fields[5]} {
+				n, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, malformed("%q is not a number", field)
+				}
+				numbers[i] = n
+			}
+			position, size, start := numbers[0], numbers[1], numbers[2]
+			if position < 0 || position >= len(k.Wheels) || k.Wheels[position] != nil {
+				return nil, malformed("wheel %d is not a new position on the machine", position)
+			}
+			if size <= 0 || start < 0 || start >= size {
+				return nil, malformed("wheel %d cannot start at %d with %d pins", position, start, size)
+			}
+			current = &Wheel{Items: make([]int, 0, size), MaxSize: size, CurrentIndex: start}
+			k.Wheels[position] = current
+
+		default:
+			if current == nil {
+				return nil, malformed("pins before the first wheel")
+			}
+			items, err := parsePins(line)
+			if err != nil {
+				return nil, malformed("%s", err.Error())
+			}
+			if len(current.Items)+len(items) > current.MaxSize {
+				return nil, malformed("more than %d pins", current.MaxSize)
+			}
+			current.Items = append(current.Items, items...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, wheel := range k.Wheels {
+		if wheel == nil {
+			return nil, &InvalidWheelError{Wheel: i, Reason: "wheel is missing from the pin sheet"}
+		}
+		if len(wheel.Items) != wheel.MaxSize {
+			return nil, &InvalidWheelError{Wheel: i, Reason: fmt.Sprintf("wheel has %d pins, but its size is %d", len(wheel.Items), wheel.MaxSize)}
+		}
+	}
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+//pinString writes the pins of a wheel in x/. notation, with a space between each group of pins if group is not 0
+func pinString(w *Wheel, group int) string {
+	var pins strings.Builder
+	for i, item := range w.Items {
+		if group > 0 && i > 0 && i%group == 0 {
+			pins.WriteString(" ")
+		}
+		pins.WriteRune([]rune(pinCharacters[item])[0])
+	}
+	return pins.String()
+}
+
+//parsePins reads pins in x/. notation, ignoring spaces
+func parsePins(s string) ([]int, error) {
+	items := []int{}
+	for _, character := range s {
+		switch {
+		case character == ' ' || character == '\t':
+		case strings.ContainsRune(pinCharacters[0], character):
+			items = append(items, 0)
+		case strings.ContainsRune(pinCharacters[1], character):
+			items = append(items, 1)
+		default:
+			return nil, fmt.Errorf("%q is not a pin", character)
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no pins")
+	}
+	return items, nil
+}
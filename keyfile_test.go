@@ -0,0 +1,158 @@
+package geheimschreiber
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+//testKey cracks the test ciphertext, and starts its wheels part of the way round
+func testKey(t *testing.T) *Key {
+	f, err := os.Open(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error opening file: %s", err.Error())
+	}
+	defer f.Close()
+	result, err := Crack(f, CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	for i, w := range result.Wheels {
+		w.CurrentIndex = (7 * i) % w.MaxSize
+	}
+	return &Key{Variant: T52D, Wheels: result.Wheels, WheelOrder: result.WheelOrder}
+}
+
+//checkKey checks that the loaded key is the same as the saved one, and encrypts the same way
+func checkKey(t *testing.T, loaded, saved *Key) {
+	if loaded.Variant != saved.Variant {
+		t.Errorf("Loaded variant %s, expected %s", loaded.Variant.Name, saved.Variant.Name)
+	}
+	for i := range saved.Wheels {
+		if !loaded.Wheels[i].Equals(*saved.Wheels[i]) || loaded.Wheels[i].CurrentIndex != saved.Wheels[i].CurrentIndex {
+			t.Errorf("Wheel %d does not match the saved key", i)
+		}
+		if loaded.WheelOrder[i] != saved.WheelOrder[i] {
+			t.Errorf("Position %d holds wheel %d, expected %d", i, loaded.WheelOrder[i], saved.WheelOrder[i])
+		}
+	}
+
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35"
+	encrypt := func(k *Key) string {
+		starts := make([]int, len(k.Wheels))
+		for i, w := range k.Wheels {
+			starts[i] = w.CurrentIndex
+		}
+		m, err := k.Machine()
+		if err != nil {
+			t.Fatalf("Error creating machine: %s", err.Error())
+		}
+		ciphertext, err := m.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		for i, w := range k.Wheels {
+			w.CurrentIndex = starts[i]
+		}
+		return ciphertext
+	}
+	if encrypt(loaded) != encrypt(saved) {
+		t.Errorf("Loaded key does not encrypt like the saved key")
+	}
+}
+
+func Test_KeyJSON(t *testing.T) {
+
+	key := testKey(t)
+	data, err := json.Marshal(key)
+	if err != nil {
+		t.Fatalf("Error saving key: %s", err.Error())
+	}
+	if !bytes.Contains(data, []byte(`"variant":"T52d"`)) {
+		t.Errorf("Saved key does not name its variant: %s", data)
+	}
+
+	var loaded Key
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Error loading key: %s", err.Error())
+	}
+	checkKey(t, &loaded, key)
+
+	order, _ := json.Marshal(key.WheelOrder)
+	orderJSON := string(order)
+	swapped := append([]int{}, key.WheelOrder...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	order, _ = json.Marshal(swapped)
+	swappedJSON := string(order)
+	for _, bad := range []string{
+		`{"variant":"T52z","wheels":[]}`,
+		`{"variant":"T52d","wheels":[{"pins":"x.x","start":0}]}`,
+		strings.Replace(string(data), `"start":7`, `"start":700`, 1),
+		strings.Replace(string(data), `"pins":"`, `"pins":"q`, 1),
+		strings.Replace(string(data), orderJSON, "[0,0,1,2,3,4,5,6,7,8]", 1),
+		strings.Replace(string(data), orderJSON, "[0,1,2,3,4,5,6,7,8,10]", 1),
+		strings.Replace(string(data), orderJSON, swappedJSON, 1),
+	} {
+		if err := json.Unmarshal([]byte(bad), &loaded); err == nil {
+			t.Errorf("Expected an error loading %.60s", bad)
+		}
+	}
+
+	custom := *key
+	custom.Variant = &Variant{Name: "T52a/b", WheelSizes: WHEEL_SIZES, Network: DEFAULT_NETWORK}
+	if _, err := json.Marshal(&custom); err == nil {
+		t.Errorf("Expected an error saving a variant that is not a preset")
+	}
+}
+
+func Test_PinSheet(t *testing.T) {
+
+	key := testKey(t)
+	var sheet bytes.Buffer
+	if err := WritePinSheet(&sheet, key); err != nil {
+		t.Fatalf("Error writing pin sheet: %s", err.Error())
+	}
+	if !strings.Contains(sheet.String(), "\nwheel 1 size ") || !strings.HasPrefix(sheet.String(), "variant T52d\norder ") {
+		t.Errorf("Unexpected pin sheet:\n%s", sheet.String())
+	}
+
+	loaded, err := ReadPinSheet(strings.NewReader(sheet.String()))
+	if err != nil {
+		t.Fatalf("Error reading pin sheet: %s", err.Error())
+	}
+	checkKey(t, loaded, key)
+
+	//Analysts may annotate the sheet, and write the pins however they like
+	annotated := "# cracked 30 June 1941\n" + strings.Replace(strings.Replace(sheet.String(), "x", "×", -1), ".", "•", -1)
+	loaded, err = ReadPinSheet(strings.NewReader(annotated))
+	if err != nil {
+		t.Fatalf("Error reading annotated pin sheet: %s", err.Error())
+	}
+	checkKey(t, loaded, key)
+
+	lines := strings.Split(sheet.String(), "\n")
+	for _, bad := range []string{
+		strings.Replace(sheet.String(), "variant T52d", "variant T52z", 1),
+		strings.Replace(sheet.String(), "wheel 3 ", "wheel 2 ", 1),
+		strings.Replace(sheet.String(), "start 7", "start 700", 1),
+		strings.Join(append(lines[:4:4], lines[5:]...), "\n"),
+		strings.Replace(sheet.String(), "\nwheel 9", "\nx\nwheel 9", 1),
+		"x.x.x\n" + sheet.String(),
+	} {
+		if _, err := ReadPinSheet(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error reading a malformed pin sheet")
+		}
+	}
+
+	//The order must fit each wheel in exactly one position, where a wheel of its size sits
+	swapped := strings.Fields(lines[1])
+	swapped[1], swapped[2] = swapped[2], swapped[1]
+	for _, order := range []string{"order 0 0 1 2 3 4 5 6 7 8", "order 1 2 3 4 5 6 7 8 9 10", "order -1 1 2 3 4 5 6 7 8 9", strings.Join(swapped, " ")} {
+		_, err := ReadPinSheet(strings.NewReader(strings.Replace(sheet.String(), lines[1], order, 1)))
+		if _, ok := err.(*InvalidWheelError); !ok {
+			t.Errorf("Expected an InvalidWheelError reading %q, got %v", order, err)
+		}
+	}
+}
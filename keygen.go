@@ -0,0 +1,114 @@
+package geheimschreiber
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+//PinRules limit the pin patterns that may be set on a wheel, as the German key setters' instructions did,
+//so that no wheel gives away too much about itself
+//A zero field places no limit
+type PinRules struct {
+	//MaxImbalance is the most by which the number of 1s on a wheel may differ from the number of 0s
+	//A wheel with an odd number of pins always differs by at least one
+	MaxImbalance int
+
+	//MaxRun is the longest run of the same pin allowed, counting round the wheel from its last pin to its first
+	MaxRun int
+}
+
+//HISTORICAL_PIN_RULES keep each wheel roughly balanced and free of long runs
+//These are representative limits; substitute the ones from the key setters' instructions if they are known
+var HISTORICAL_PIN_RULES = PinRules{MaxImbalance: 5, MaxRun: 5}
+
+//KEYGEN_ATTEMPTS is the number of patterns tried for each wheel before GenerateKeyWithRules gives up
+var KEYGEN_ATTEMPTS = 10000
+
+//GenerateKey creates a new key for the variant: its wheels are fitted in a random order, each with
+//random pins and a random start position
+//If rng is nil, a source seeded with 1 is used, so keys are reproducible; if the variant is nil, T52AB is used
+func GenerateKey(rng *rand.Rand, v *Variant) (*Key, error) {
+	return GenerateKeyWithRules(rng, v, PinRules{})
+}
+
+//GenerateKeyWithRules is like GenerateKey, but the pins of every wheel follow the rules
+//It returns an InvalidWheelError if no pattern that follows the rules is found for a wheel
+func GenerateKeyWithRules(rng *rand.Rand, v *Variant, rules PinRules) (*Key, error) {
+	if rng == nil {
+		rng = rand.New(rand.NewSource(1))
+	}
+	k := &Key{Variant: v}
+	if err := k.variant().Validate(); err != nil {
+		return nil, err
+	}
+
+	k.WheelOrder = rng.Perm(len(k.variant().WheelSizes))
+	for position, index := range k.WheelOrder {
+		items, ok := randomPins(rng, k.variant().WheelSizes[index], rules)
+		if !ok {
+			return nil, &InvalidWheelError{Wheel: position, Reason: fmt.Sprintf("no pattern of %d pins found that follows the rules", k.variant().WheelSizes[index])}
+		}
+		w := NewWheel(items)
+		w.CurrentIndex = rng.Intn(w.MaxSize)
+		k.Wheels = append(k.Wheels, w)
+	}
+	return k, nil
+}
+
+//randomPins picks a pattern of pins that follows the rules, trying up to KEYGEN_ATTEMPTS times
+//Each pin is picked at random, except that a run is broken as soon as it reaches rules.MaxRun
+func randomPins(rng *rand.Rand, size int, rules PinRules) ([]int, bool) {
+	items := make([]int, size)
+	for attempt := 0; attempt < KEYGEN_ATTEMPTS; attempt++ {
+		run := 0
+		for i := range items {
+			items[i] = rng.Intn(2)
+			if i > 0 && items[i] == items[i-1] {
+				run++
+			} else {
+				run = 1
+			}
+			if rules.MaxRun > 0 && run > rules.MaxRun {
+				items[i], run = 1-items[i], 1
+			}
+		}
+		if rules.follows(items) {
+			return items, true
+		}
+	}
+	return nil, false
+}
+
+//follows reports whether the pins of a wheel follow the rules
+func (rules PinRules) follows(items []int) bool {
+	if rules.MaxImbalance > 0 {
+		ones := 0
+		for _, item := range items {
+			ones += item
+		}
+		imbalance := 2*ones - len(items)
+		if imbalance > rules.MaxImbalance || -imbalance > rules.MaxImbalance {
+			return false
+		}
+	}
+	return rules.MaxRun <= 0 || LongestRun(items) <= rules.MaxRun
+}
+
+//LongestRun returns the length of the longest run of the same pin on a wheel, counting round from its last pin
+//to its first, as limited by PinRules.MaxRun
+func LongestRun(items []int) int {
+	longest := 0
+	for start := range items {
+		if start > 0 && items[start] == items[start-1] {
+			continue
+		}
+		length := 0
+		for length < len(items) && items[(start+length)%len(items)] == items[start] {
+			length++
+		}
+		if length > longest {
+			longest = length
+		}
+	}
+	return longest
+}
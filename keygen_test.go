@@ -0,0 +1,113 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func Test_GenerateKey(t *testing.T) {
+
+	for _, v := range []*Variant{T52AB, T52C, T52D} {
+		k, err := GenerateKey(rand.New(rand.NewSource(7)), v)
+		if err != nil {
+			t.Fatalf("Error generating key: %s", err.Error())
+		}
+		again, _ := GenerateKey(rand.New(rand.NewSource(7)), v)
+		for i := range k.Wheels {
+			if !k.Wheels[i].Equals(*again.Wheels[i]) || k.Wheels[i].CurrentIndex != again.Wheels[i].CurrentIndex {
+				t.Errorf("Keys generated from the same seed differ at wheel %d", i)
+			}
+			if k.Wheels[i].MaxSize != v.WheelSizes[k.WheelOrder[i]] {
+				t.Errorf("Wheel %d has %d pins, but wheel %d of the %s has %d", i, k.Wheels[i].MaxSize, k.WheelOrder[i], v.Name, v.WheelSizes[k.WheelOrder[i]])
+			}
+		}
+		order := append([]int{}, k.WheelOrder...)
+		sort.Ints(order)
+		for i := range order {
+			if order[i] != i {
+				t.Errorf("Wheel order %v does not fit each wheel exactly once", k.WheelOrder)
+				break
+			}
+		}
+		if _, err := k.Machine(); err != nil {
+			t.Errorf("Error creating machine from the key: %s", err.Error())
+		}
+	}
+
+	if _, err := GenerateKey(nil, &Variant{Name: "broken", WheelSizes: []int{47}}); err == nil {
+		t.Errorf("Expected an error generating a key for a variant with one wheel")
+	}
+}
+
+func Test_GenerateKeyWithRules(t *testing.T) {
+
+	rng := rand.New(rand.NewSource(11))
+	for trial := 0; trial < 20; trial++ {
+		k, err := GenerateKeyWithRules(rng, nil, HISTORICAL_PIN_RULES)
+		if err != nil {
+			t.Fatalf("Error generating key: %s", err.Error())
+		}
+		for i, w := range k.Wheels {
+			ones := 0
+			for _, item := range w.Items {
+				ones += item
+			}
+			if imbalance := 2*ones - w.MaxSize; imbalance > HISTORICAL_PIN_RULES.MaxImbalance || -imbalance > HISTORICAL_PIN_RULES.MaxImbalance {
+				t.Errorf("Wheel %d has %d 1s out of %d", i, ones, w.MaxSize)
+			}
+			if run := LongestRun(w.Items); run > HISTORICAL_PIN_RULES.MaxRun {
+				t.Errorf("Wheel %d has a run of %d", i, run)
+			}
+		}
+	}
+
+	if run := LongestRun([]int{1, 1, 0, 0, 0, 1, 1, 1}); run != 5 {
+		t.Errorf("Longest run round the wheel is %d, expected 5", run)
+	}
+
+	//A wheel with an odd number of pins cannot alternate all the way round
+	if _, err := GenerateKeyWithRules(rng, nil, PinRules{MaxRun: 1}); err == nil {
+		t.Errorf("Expected an error for rules that no wheel can follow")
+	}
+}
+
+//Test_CrackGeneratedKey checks that the cracker recovers a freshly generated key from traffic sent with it
+func Test_CrackGeneratedKey(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	k, err := GenerateKeyWithRules(rand.New(rand.NewSource(3)), T52AB, HISTORICAL_PIN_RULES)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err.Error())
+	}
+	starts := make([]int, len(k.Wheels))
+	for i, w := range k.Wheels {
+		starts[i] = w.CurrentIndex
+	}
+	m, _ := k.Machine()
+	ciphertext, err := m.Encrypt(string(bts))
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	result, err := Crack(strings.NewReader(ciphertext), CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking: %s", err.Error())
+	}
+	for i, w := range result.Wheels {
+		if result.WheelOrder[i] != k.WheelOrder[i] {
+			t.Errorf("Position %d holds wheel %d, expected %d", i, result.WheelOrder[i], k.WheelOrder[i])
+		}
+		//The cracked wheels start where the key's wheels did, so compare them from there
+		start := starts[i]
+		rotated := append(append([]int{}, k.Wheels[i].Items[start:]...), k.Wheels[i].Items[:start]...)
+		if !w.Equals(*NewWheel(rotated)) {
+			t.Errorf("Cracked wheel %d does not match the key", i)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//CHI_SIZES, PSI_SIZES and MOTOR_SIZES are the sizes of the wheels on the Lorenz SZ40/42
+//The motor wheels are the 61 (which turns after every character) and the 37 (the basic motor)
+var CHI_SIZES = []int{41, 31, 29, 26, 23}
+var PSI_SIZES = []int{43, 47, 51, 53, 59}
+var MOTOR_SIZES = []int{61, 37}
+
+//Limitation describes which earlier bits stop the psi wheels from turning on the SZ42
+//With no limitation (the SZ40), the psi wheels turn whenever the basic motor reads a 1 (a cross)
+//Otherwise, the limitation is the XOR of the selected bits, and the psi wheels stay still only if
+//the basic motor reads a 0 (a dot) and the limitation is 1
+type Limitation struct {
+	//Chi2 uses the bit that chi wheel 2 read for the previous character
+	Chi2 bool
+
+	//Psi1 uses the bit that psi wheel 1 read for the previous character
+	Psi1 bool
+
+	//P5 uses the fifth impulse of the plaintext character two back (the "autoclave")
+	P5 bool
+}
+
+//SZ40 has no limitation
+var SZ40 = Limitation{}
+
+//SZ42A limits the psi wheels with chi wheel 2 one back
+var SZ42A = Limitation{Chi2: true}
+
+//SZ42B limits the psi wheels with chi wheel 2 and psi wheel 1 one back
+var SZ42B = Limitation{Chi2: true, Psi1: true}
+
+//Lorenz is a Lorenz SZ40/42 (Tunny), which XORs each character with the bits of a chi wheel
+//and a psi wheel for each impulse, and has no transposition
+//Chi[0] and Psi[0] are XORed into impulse 1, the most significant bit of each character
+//The chi wheels and the 61 motor turn after every character; the 37 motor turns whenever the 61 reads a 1,
+//and the psi wheels all turn together whenever the total motor (see Limitation) is 1
+type Lorenz struct {
+	Chi   []*Wheel
+	Psi   []*Wheel
+	Motor []*Wheel
+
+	Limitation Limitation
+
+	//Alphabet is the notation that messages are written in
+	//If nil, BLETCHLEY_ALPHABET is used
+	Alphabet *Alphabet
+
+	//The bits that the limitation needs from earlier characters
+	chi2Back int
+	psi1Back int
+	p5Back   [2]int
+}
+
+//NewLorenz creates a Lorenz from its chi, psi and motor wheels, which must have the sizes in
+//CHI_SIZES, PSI_SIZES and MOTOR_SIZES
+//It returns an InvalidWheelError if any wheel is missing, invalid or the wrong size; the wheels
+//are numbered from 0 across the chi, psi and motor wheels, in that order
+func NewLorenz(chi, psi, motor []*Wheel, limitation Limitation) (*Lorenz, error) {
+	wheels := append(append(append([]*Wheel{}, chi...), psi...), motor...)
+	sizes := append(append(append([]int{}, CHI_SIZES...), PSI_SIZES...), MOTOR_SIZES...)
+	if len(chi) != len(CHI_SIZES) || len(psi) != len(PSI_SIZES) || len(motor) != len(MOTOR_SIZES) {
+		return nil, &InvalidWheelError{Wheel: -1, Reason: fmt.Sprintf("expected %d chi, %d psi and %d motor wheels", len(CHI_SIZES), len(PSI_SIZES), len(MOTOR_SIZES))}
+	}
+	for i, w := range wheels {
+		if err := validateWheel(w); err != nil {
+			return nil, &InvalidWheelError{Wheel: i, Reason: err.Error()}
+		}
+		if w.MaxSize != sizes[i] {
+			return nil, &InvalidWheelError{Wheel: i, Reason: fmt.Sprintf("wheel has %d spokes, expected %d", w.MaxSize, sizes[i])}
+		}
+	}
+	return &Lorenz{Chi: chi, Psi: psi, Motor: motor, Limitation: limitation}, nil
+}
+
+//Wheels returns the twelve wheels: the chi wheels, then the psi wheels, then the motor wheels
+func (l *Lorenz) Wheels() []*Wheel {
+	return append(append(append([]*Wheel{}, l.Chi...), l.Psi...), l.Motor...)
+}
+
+//Reset turns every wheel back to its first spoke, and forgets the earlier characters
+func (l *Lorenz) Reset() {
+	ResetWheels(l.Wheels())
+	l.chi2Back = 0
+	l.psi1Back = 0
+	l.p5Back = [2]int{}
+}
+
+//Encrypt encrypts the plaintext, continuing from the current position of the wheels
+//Line breaks are passed through unchanged, and do not turn the wheels
+func (l *Lorenz) Encrypt(plaintext string) (string, error) {
+	return l.process(plaintext, true)
+}
+
+//Decrypt decrypts the ciphertext, continuing from the current position of the wheels
+//Line breaks are passed through unchanged, and do not turn the wheels
+func (l *Lorenz) Decrypt(ciphertext string) (string, error) {
+	return l.process(ciphertext, false)
+}
+
+//process encrypts or decrypts the text; the only difference is which side is the plaintext,
+//which the P5 limitation needs
+func (l *Lorenz) process(text string, encrypt bool) (string, error) {
+	var result strings.Builder
+	alphabet := l.Alphabet.orDefault()
+	for _, character := range text {
+
+		char := string(character)
+		if char == "\n" || char == "\r" {
+			result.WriteString(char)
+			continue
+		}
+		c, ok := alphabet.Code(character)
+		if !ok {
+			return "", errors.New("error: character not in alphabet")
+		}
+		result.WriteRune(alphabet.Symbol(int(l.processSymbol(uint8(c), encrypt))))
+	}
+	return result.String(), nil
+}
+
+//processSymbol encrypts or decrypts a single symbol, and turns the wheels
+func (l *Lorenz) processSymbol(symbol uint8, encrypt bool) uint8 {
+	out := int(symbol) ^ l.chiCharacter() ^ l.psiCharacter()
+	plain := int(symbol)
+	if !encrypt {
+		plain = out
+	}
+	l.step(plain)
+	return uint8(out)
+}
+
+//chiCharacter returns the bits of the chi wheels at their current positions, chi 1 most significant
+func (l *Lorenz) chiCharacter() int {
+	return wheelCharacter(l.Chi)
+}
+
+//psiCharacter returns the bits of the psi wheels at their current positions, psi 1 most significant
+func (l *Lorenz) psiCharacter() int {
+	return wheelCharacter(l.Psi)
+}
+
+//wheelCharacter combines the current bits of five wheels into a character, the first wheel most significant
+func wheelCharacter(wheels []*Wheel) int {
+	c := 0
+	for _, w := range wheels {
+		c = c<<1 | w.Items[w.CurrentIndex]
+	}
+	return c
+}
+
+//totalMotor returns 1 if the psi wheels turn after the current character
+func (l *Lorenz) totalMotor() int {
+	basicMotor := l.Motor[1].Items[l.Motor[1].CurrentIndex]
+	if l.Limitation == SZ40 {
+		return basicMotor
+	}
+
+	limitation := 0
+	if l.Limitation.Chi2 {
+		limitation ^= l.chi2Back
+	}
+	if l.Limitation.Psi1 {
+		limitation ^= l.psi1Back
+	}
+	if l.Limitation.P5 {
+		limitation ^= l.p5Back[1]
+	}
+	if basicMotor == 0 && limitation == 1 {
+		return 0
+	}
+	return 1
+}
+
+//step turns the wheels after a character, given its plaintext
+func (l *Lorenz) step(plain int) {
+	psiTurns := l.totalMotor() == 1
+	motorTurns := l.Motor[0].Items[l.Motor[0].CurrentIndex] == 1
+
+	l.chi2Back = l.Chi[1].Items[l.Chi[1].CurrentIndex]
+	l.psi1Back = l.Psi[0].Items[l.Psi[0].CurrentIndex]
+	l.p5Back = [2]int{getNthBit(plain, 0), l.p5Back[0]}
+
+	TickAll(l.Chi)
+	if psiTurns {
+		TickAll(l.Psi)
+	}
+	if motorTurns {
+		l.Motor[1].Tick()
+	}
+	l.Motor[0].Tick()
+}
@@ -0,0 +1,109 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+//lorenzTestWheels returns random chi, psi and motor wheels of the standard sizes
+func lorenzTestWheels(seed int64) (chi, psi, motor []*Wheel) {
+	r := rand.New(rand.NewSource(seed))
+	wheels := func(sizes []int) []*Wheel {
+		result := []*Wheel{}
+		for _, size := range sizes {
+			items := make([]int, size)
+			for i := range items {
+				items[i] = r.Intn(2)
+			}
+			result = append(result, NewWheel(items))
+		}
+		return result
+	}
+	return wheels(CHI_SIZES), wheels(PSI_SIZES), wheels(MOTOR_SIZES)
+}
+
+func Test_LorenzRoundTrip(t *testing.T) {
+
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35\nFROM4THE4SZ4FORTY4TWO"
+	for _, limitation := range []Limitation{SZ40, SZ42A, SZ42B, {Chi2: true, P5: true}} {
+		chi, psi, motor := lorenzTestWheels(1)
+		l, err := NewLorenz(chi, psi, motor, limitation)
+		if err != nil {
+			t.Fatalf("Error creating Lorenz: %s", err.Error())
+		}
+
+		ciphertext, err := l.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		if ciphertext == plaintext {
+			t.Errorf("Encrypting with %+v did not change the message", limitation)
+		}
+
+		l.Reset()
+		decrypted, err := l.Decrypt(ciphertext)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("Message did not survive a round trip with %+v: %q", limitation, decrypted)
+		}
+	}
+}
+
+func Test_LorenzStepping(t *testing.T) {
+
+	chi, psi, motor := lorenzTestWheels(2)
+	motor[0] = NewWheel(make([]int, MOTOR_SIZES[0]))
+	motor[1] = NewWheel(make([]int, MOTOR_SIZES[1]))
+	l, err := NewLorenz(chi, psi, motor, SZ40)
+	if err != nil {
+		t.Fatalf("Error creating Lorenz: %s", err.Error())
+	}
+
+	//With the motors all dots, the 37 and the psi wheels never move
+	if _, err := l.Encrypt("UMUM4VEVE35KING4HENRY4IV35"); err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	for i, w := range l.Psi {
+		if w.CurrentIndex != 0 {
+			t.Errorf("Psi wheel %d moved without the motor", i+1)
+		}
+	}
+	if l.Motor[1].CurrentIndex != 0 {
+		t.Errorf("The 37 moved while the 61 read dots")
+	}
+	if l.Chi[0].CurrentIndex != 26 || l.Motor[0].CurrentIndex != 26 {
+		t.Errorf("Expected the chi wheels and the 61 to turn after every character")
+	}
+
+	//The SZ42A limitation moves the psi wheels whenever chi 2 one back is a dot
+	l.Reset()
+	l.Limitation = SZ42A
+	expected := 0
+	for i := 0; i < 26; i++ {
+		if i == 0 || chi[1].Items[i-1] == 0 {
+			expected++
+		}
+	}
+	if _, err := l.Encrypt("UMUM4VEVE35KING4HENRY4IV35"); err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	if l.Psi[0].CurrentIndex != expected {
+		t.Errorf("Psi wheels turned %d times, expected %d", l.Psi[0].CurrentIndex, expected)
+	}
+}
+
+func Test_LorenzErrors(t *testing.T) {
+
+	chi, psi, motor := lorenzTestWheels(3)
+	_, err := NewLorenz(chi, psi, motor[:1], SZ40)
+	var wheelErr *InvalidWheelError
+	if !errors.As(err, &wheelErr) || wheelErr.Wheel != -1 {
+		t.Errorf("Expected an invalid wheel error for a missing motor, got %v", err)
+	}
+
+	psi[2] = NewWheel([]int{0, 1})
+	_, err = NewLorenz(chi, psi, motor, SZ40)
+	if !errors.As(err, &wheelErr) || wheelErr.Wheel != 7 {
+		t.Errorf("Expected an invalid wheel error for psi wheel 3, got %v", err)
+	}
+}
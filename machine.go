@@ -0,0 +1,210 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//Machine is a Geheimschreiber, set up with its wheels
+//Its wheels are shared with the slice it was created from, so encrypting with the Machine
+//turns the wheels in that slice too
+type Machine struct {
+	//XORWheels are the five wheels (0-4) whose bits are XORed into each character;
+	//XORWheels[0] is XORed into the most significant bit
+	XORWheels []*Wheel
+
+	//TransposeWheels are the five wheels (5-9) that control the swaps in Network
+	TransposeWheels []*Wheel
+
+	//Network is the permutation network that the transpose wheels control
+	//If nil, DEFAULT_NETWORK is used
+	Network PermutationNetwork
+
+	//Controls gives the wheels whose bits are XORed together to drive each of the ten controls,
+	//as in Variant; if nil, each control is driven by the wheel in the same position
+	//When it is set, the wheels in XORWheels and TransposeWheels are just the wheels in positions 0-4 and 5-9
+	Controls [][]int
+
+	//Stepper decides how far each wheel turns after each character
+	//If nil, every wheel turns once per character
+	//A PinControlledStepper must pass Validate; if it does not, encrypting and decrypting return its error
+	Stepper Stepper
+
+	//Alphabet is the notation that messages are written in
+	//If nil, BLETCHLEY_ALPHABET is used
+	Alphabet *Alphabet
+}
+
+//NewMachine creates a Machine with DEFAULT_NETWORK from ten wheels, in the order they sit on the machine
+//It returns an InvalidWheelError if there are not exactly ten wheels, or one of them is not a valid wheel
+func NewMachine(wheels []*Wheel) (*Machine, error) {
+	return NewMachineWithNetwork(wheels, DEFAULT_NETWORK)
+}
+
+//NewMachineWithNetwork is like NewMachine, but the transpose wheels control the given permutation network
+func NewMachineWithNetwork(wheels []*Wheel, network PermutationNetwork) (*Machine, error) {
+	if err := network.Validate(); err != nil {
+		return nil, err
+	}
+	if len(wheels) != 10 {
+		return nil, &InvalidWheelError{Wheel: -1, Reason: fmt.Sprintf("expected ten wheels, got %d", len(wheels))}
+	}
+	for i, w := range wheels {
+		if err := validateWheel(w); err != nil {
+			return nil, &InvalidWheelError{Wheel: i, Reason: err.Error()}
+		}
+	}
+	return &Machine{XORWheels: wheels[:5], TransposeWheels: wheels[5:], Network: network}, nil
+}
+
+//validateWheel checks that the wheel has at least one spoke, that every spoke is 0 or 1,
+//and that its current position is on the wheel
+func validateWheel(w *Wheel) error {
+	if w == nil {
+		return errors.New("wheel is nil")
+	}
+	if w.MaxSize <= 0 {
+		return errors.New("wheel has no spokes")
+	}
+	if len(w.Items) != w.MaxSize {
+		return fmt.Errorf("wheel has %d spokes, but its size is %d", len(w.Items), w.MaxSize)
+	}
+	for i, item := range w.Items {
+		if item != 0 && item != 1 {
+			return fmt.Errorf("spoke %d is %d, not 0 or 1", i, item)
+		}
+	}
+	if w.CurrentIndex < 0 || w.CurrentIndex >= w.MaxSize {
+		return fmt.Errorf("current position %d is not on the wheel", w.CurrentIndex)
+	}
+	return nil
+}
+
+//Wheels returns the ten wheels, in the order they sit on the machine
+func (m *Machine) Wheels() []*Wheel {
+	return append(append([]*Wheel{}, m.XORWheels...), m.TransposeWheels...)
+}
+
+//Reset turns every wheel back to its first spoke
+func (m *Machine) Reset() {
+	ResetWheels(m.Wheels())
+}
+
+//Encrypt encrypts the plaintext, continuing from the current position of the wheels
+//Line breaks are passed through unchanged, and do not turn the wheels
+func (m *Machine) Encrypt(plaintext string) (string, error) {
+	var result strings.Builder
+	for _, character := range plaintext {
+
+		char := string(character)
+		if char == "\n" || char == "\r" {
+			result.WriteString(char)
+			continue
+		}
+		encrypted, err := m.encryptCharacter(character)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(encrypted)
+	}
+	return result.String(), nil
+}
+
+//Decrypt decrypts the ciphertext, continuing from the current position of the wheels
+//Line breaks are passed through unchanged, and do not turn the wheels
+func (m *Machine) Decrypt(ciphertext string) (string, error) {
+	var result strings.Builder
+	for _, character := range ciphertext {
+
+		char := string(character)
+		if char == "\n" || char == "\r" {
+			result.WriteString(char)
+			continue
+		}
+		decrypted, err := m.decryptCharacter(character)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(decrypted)
+	}
+	return result.String(), nil
+}
+
+//encryptCharacter encrypts a single character, and turns every wheel forward
+func (m *Machine) encryptCharacter(character rune) (string, error) {
+	if err := validateStepper(m.Stepper); err != nil {
+		return "", err
+	}
+	alphabet := m.Alphabet.orDefault()
+	c, ok := alphabet.Code(character)
+	if !ok {
+		return "", errors.New("error: character not in alphabet")
+	}
+	return string(alphabet.Symbol(int(m.encryptSymbol(uint8(c))))), nil
+}
+
+//decryptCharacter decrypts a single character, and turns every wheel forward
+func (m *Machine) decryptCharacter(character rune) (string, error) {
+	if err := validateStepper(m.Stepper); err != nil {
+		return "", err
+	}
+	alphabet := m.Alphabet.orDefault()
+	c, ok := alphabet.Code(character)
+	if !ok {
+		return "", errors.New("error: character not in alphabet")
+	}
+	return string(alphabet.Symbol(int(m.decryptSymbol(uint8(c))))), nil
+}
+
+//Keystream returns the effect of the wheels on each of the next n characters, without needing any plaintext,
+//and turns the wheels as if n characters had been encrypted
+//KeystreamCharacter.XOR is the mask XORed into each character, and KeystreamCharacter.Transpose holds the bits
+//that control the swaps in Network; Network.Permutation says where they move each bit
+//When Controls is set, these are the bits of the controls rather than of the wheels
+func (m *Machine) Keystream(n int) []KeystreamCharacter {
+	keystream := make([]KeystreamCharacter, n)
+	for i := range keystream {
+		bits := m.currentBits()
+		for j := 0; j < 5; j++ {
+			keystream[i].XOR |= bits[j] << uint(4-j)
+			keystream[i].Transpose |= bits[5+j] << uint(4-j)
+		}
+	}
+	return keystream
+}
+
+//currentBits reads the current bit on each of the ten wheels, turns the wheels forward,
+//and returns the ten controls that the bits drive
+func (m *Machine) currentBits() [10]int {
+	var bits [10]int
+	for i, w := range m.XORWheels {
+		bits[i] = w.Items[w.CurrentIndex]
+	}
+	for i, w := range m.TransposeWheels {
+		bits[5+i] = w.Items[w.CurrentIndex]
+	}
+	m.step(bits)
+	return controlBits(m.Controls, bits)
+}
+
+//step turns each wheel as far as the stepper says it should, given the bits the wheels just read
+func (m *Machine) step(bits [10]int) {
+	if m.Stepper == nil {
+		TickAll(m.XORWheels)
+		TickAll(m.TransposeWheels)
+		return
+	}
+
+	var known [10]*int
+	for i := range bits {
+		known[i] = &bits[i]
+	}
+	steps := m.Stepper.Steps(known)
+	for i, w := range m.XORWheels {
+		w.SetPosition(w.CurrentIndex + steps[i])
+	}
+	for i, w := range m.TransposeWheels {
+		w.SetPosition(w.CurrentIndex + steps[5+i])
+	}
+}
@@ -0,0 +1,183 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func Test_Machine(t *testing.T) {
+
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35\nUMUM4VEVE35SO4SHAKEN4AS4WE4ARE4SO4WAN4WITH4CARE35"
+	ciphertext, err := m.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	ResetWheels(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	expected, err := EncryptString(TEST_CIPHERTEXT_SOLVED_WHEELS, plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	if ciphertext != expected {
+		t.Errorf("Machine encrypted to %q, expected %q", ciphertext, expected)
+	}
+
+	m.Reset()
+	decrypted, err := m.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	if decrypted != plaintext {
+		t.Errorf("Machine decrypted to %q, expected %q", decrypted, plaintext)
+	}
+	m.Reset()
+}
+
+func Test_NewMachineErrors(t *testing.T) {
+
+	wheels := func() []*Wheel {
+		return []*Wheel{NewWheel([]int{0, 1}), NewWheel([]int{1}), NewWheel([]int{0}), NewWheel([]int{1, 1}), NewWheel([]int{0, 0}),
+			NewWheel([]int{1, 0}), NewWheel([]int{0}), NewWheel([]int{1}), NewWheel([]int{0, 1, 1}), NewWheel([]int{1, 0, 0})}
+	}
+	if _, err := NewMachine(wheels()); err != nil {
+		t.Fatalf("Unexpected error for valid wheels: %s", err.Error())
+	}
+
+	tooFew := wheels()[:9]
+	nilWheel := wheels()
+	nilWheel[3] = nil
+	badSpoke := wheels()
+	badSpoke[7] = NewWheel([]int{2})
+	empty := wheels()
+	empty[0] = NewWheel([]int{})
+	badPosition := wheels()
+	badPosition[9].CurrentIndex = 3
+
+	for _, tc := range []struct {
+		wheels []*Wheel
+		wheel  int
+	}{{tooFew, -1}, {nilWheel, 3}, {badSpoke, 7}, {empty, 0}, {badPosition, 9}} {
+		_, err := NewMachine(tc.wheels)
+		var wheelErr *InvalidWheelError
+		if !errors.As(err, &wheelErr) || wheelErr.Wheel != tc.wheel {
+			t.Errorf("Expected an invalid wheel error for wheel %d, got %v", tc.wheel, err)
+		}
+	}
+
+	if _, err := EncryptString(tooFew, "KING"); err == nil {
+		t.Errorf("Expected EncryptString to reject nine wheels")
+	}
+}
+
+func Test_MachineKeystream(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintext, err := BLETCHLEY_ALPHABET.Symbols(string(bts))
+	if err != nil {
+		t.Fatalf("Error converting to symbols: %s", err.Error())
+	}
+
+	for _, name := range []string{"T52a/b", "T52d"} {
+		v, err := VariantByName(name)
+		if err != nil {
+			t.Fatalf("Error finding variant: %s", err.Error())
+		}
+		m, err := NewVariantMachine(v, TEST_CIPHERTEXT_SOLVED_WHEELS)
+		if err != nil {
+			t.Fatalf("Error creating %s: %s", name, err.Error())
+		}
+		m.Reset()
+		ciphertext, err := m.EncryptSymbols(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		m.Reset()
+		keystream := m.Keystream(len(plaintext))
+		m.Reset()
+
+		//The keystream alone enciphers the plaintext
+		for i, k := range keystream {
+			if encipherWithKeystream(m.Network, k, int(plaintext[i])) != int(ciphertext[i]) {
+				t.Fatalf("%s: keystream at position %d does not encipher the plaintext", name, i)
+			}
+		}
+	}
+
+	//With wheels that are half 1s, the permutations are as likely as the network says
+	rng := rand.New(rand.NewSource(1))
+	wheels := make([]*Wheel, 10)
+	for i, size := range WHEEL_SIZES {
+		items := make([]int, size)
+		for j := range items {
+			items[j] = j % 2
+		}
+		rng.Shuffle(size, func(a, b int) { items[a], items[b] = items[b], items[a] })
+		wheels[i] = NewWheel(items)
+	}
+	m, err := NewMachine(wheels)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	keystream := m.Keystream(50000)
+	var moves [5][5]float64
+	for _, k := range keystream {
+		for bit, destination := range m.Network.Permutation(k.Transpose) {
+			moves[bit][destination]++
+		}
+	}
+	probs := m.Network.TransposeProbs()
+	for bit := range moves {
+		for destination := range moves[bit] {
+			if p := moves[bit][destination] / float64(len(keystream)); math.Abs(p-probs[bit][destination]) > 0.02 {
+				t.Errorf("Bit %d moved to %d with probability %.3f, expected %.3f", bit, destination, p, probs[bit][destination])
+			}
+		}
+	}
+
+	//A machine set up without a network uses DEFAULT_NETWORK, and its keystream must say so
+	plain := &Machine{XORWheels: m.XORWheels, TransposeWheels: m.TransposeWheels}
+	plain.Reset()
+	ciphertext, err := plain.EncryptSymbols(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	plain.Reset()
+	for i, k := range plain.Keystream(len(plaintext)) {
+		if encipherWithKeystream(plain.Network, k, int(plaintext[i])) != int(ciphertext[i]) {
+			t.Fatalf("Keystream of a machine without a network does not encipher the plaintext at position %d", i)
+		}
+	}
+	if !reflect.DeepEqual(PermutationNetwork(nil).InferenceTable(), DEFAULT_NETWORK.InferenceTable()) {
+		t.Errorf("Inference table of a nil network differs from DEFAULT_NETWORK's")
+	}
+
+	if DEFAULT_NETWORK.Permutation(0) != [5]int{0, 1, 2, 3, 4} {
+		t.Errorf("Expected no swaps to leave every bit in place")
+	}
+	if DEFAULT_NETWORK.Permutation(16) != [5]int{4, 1, 2, 3, 0} {
+		t.Errorf("Expected the first swap to interchange bits 0 and 4, got %v", DEFAULT_NETWORK.Permutation(16))
+	}
+}
+
+//encipherWithKeystream XORs the character with the keystream's mask, and moves each bit where its permutation says
+func encipherWithKeystream(network PermutationNetwork, k KeystreamCharacter, c int) int {
+	c ^= k.XOR
+	enciphered := 0
+	for bit, destination := range network.Permutation(k.Transpose) {
+		enciphered |= getNthBit(c, 4-bit) << uint(4-destination)
+	}
+	return enciphered
+}
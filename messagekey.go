@@ -0,0 +1,278 @@
+package geheimschreiber
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//MessageKey holds the starting position of each wheel for a single message
+type MessageKey []int
+
+//ErrAmbiguousMessageKey is returned when the cribs for a message fit more than one message key
+var ErrAmbiguousMessageKey = errors.New("error: the cribs do not determine the message key")
+
+//ErrNoMessageKey is returned when no message key fits the cribs for a message
+var ErrNoMessageKey = errors.New("error: no message key is consistent with the cribs")
+
+//SetPosition turns the wheel so that the given spoke is the next one read
+func (w *Wheel) SetPosition(position int) {
+	w.CurrentIndex = ((position % w.MaxSize) + w.MaxSize) % w.MaxSize
+}
+
+//SetMessageKey turns each wheel to its starting position in the message key
+//It returns an InvalidWheelError, without turning any wheel, if one of them is not a valid wheel
+func SetMessageKey(wheels []*Wheel, key MessageKey) error {
+	if len(key) != len(wheels) {
+		return fmt.Errorf("error: message key has %d positions, but there are %d wheels", len(key), len(wheels))
+	}
+	for i, w := range wheels {
+		if err := validateWheel(w); err != nil {
+			return &InvalidWheelError{Wheel: i, Reason: err.Error()}
+		}
+	}
+	for i, w := range wheels {
+		w.SetPosition(key[i])
+	}
+	return nil
+}
+
+//EncryptStringWithKey is like EncryptString, but it first turns the wheels to the positions in the message key
+func EncryptStringWithKey(wheels []*Wheel, key MessageKey, plaintext string) (string, error) {
+	if err := SetMessageKey(wheels, key); err != nil {
+		return "", err
+	}
+	return EncryptString(wheels, plaintext)
+}
+
+//DecryptStringWithKey is like DecryptString, but it first turns the wheels to the positions in the message key
+func DecryptStringWithKey(wheels []*Wheel, key MessageKey, ciphertext string) (string, error) {
+	if err := SetMessageKey(wheels, key); err != nil {
+		return "", err
+	}
+	return DecryptString(wheels, ciphertext)
+}
+
+//RecoverMessageKeys reads a series of encrypted messages (one per line), each of which was sent with
+//its own message key, and recovers the message keys from the known wheels and opts.Cribs
+//(DEFAULT_CRIBS, if nil), enciphered through opts.Network; the messages and cribs are written in opts.Alphabet
+//Every wheel must turn once per character; opts.Stepper, and the other options, are not used
+//The cribs must pin down roughly as many bits as there are in the message key; if they do not,
+//a MessageKeyError wrapping ErrAmbiguousMessageKey is returned (or ErrNoMessageKey, if no key fits)
+func RecoverMessageKeys(wheels []*Wheel, r io.Reader, opts CrackOptions) ([]MessageKey, error) {
+	if len(wheels) != 10 {
+		return nil, errors.New("error: expected ten wheels")
+	}
+	for i, w := range wheels {
+		if err := validateWheel(w); err != nil {
+			return nil, &InvalidWheelError{Wheel: i, Reason: err.Error()}
+		}
+	}
+	alphabet := opts.Alphabet.orDefault()
+	cribs := opts.Cribs
+	if cribs == nil {
+		cribs = defaultCribs(alphabet)
+	}
+	network := opts.Network.orDefault()
+
+	keys := []MessageKey{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		currentLine := strings.TrimRight(scanner.Text(), "\r")
+		if currentLine == "" {
+			continue
+		}
+
+		ciphertext, plaintext, err := parseMessage(currentLine, cribs, len(keys)+1, lineNumber, alphabet)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := recoverMessageKey(wheels, network, ciphertext, plaintext)
+		if err != nil {
+			return nil, &MessageKeyError{Line: lineNumber, Err: err}
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+//keyObservation is a single character of a message whose plaintext is known
+type keyObservation struct {
+	position int
+
+	//allowed holds every setting of the ten wheels' bits that encrypts the plaintext character to
+	//the ciphertext character; bit i of each setting is the bit on wheel i
+	allowed []int
+}
+
+//recoverMessageKey finds the only message key under which the known plaintext of the message
+//("-" where unknown) encrypts to the ciphertext through the network
+func recoverMessageKey(wheels []*Wheel, network PermutationNetwork, ciphertext, plaintext string) (MessageKey, error) {
+	observations := []keyObservation{}
+	for position := range plaintext {
+		if plaintext[position] == '-' {
+			continue
+		}
+		plainInt, _ := BLETCHLEY_ALPHABET.Code(rune(plaintext[position]))
+		cipherInt, _ := BLETCHLEY_ALPHABET.Code(rune(ciphertext[position]))
+
+		o := keyObservation{position: position}
+		for setting := 0; setting < 1<<uint(len(wheels)); setting++ {
+			var bits [10]int
+			for i := range bits {
+				bits[i] = getNthBit(setting, i)
+			}
+			if network.encryptWithBits(plainInt, bits) == cipherInt {
+				o.allowed = append(o.allowed, setting)
+			}
+		}
+		observations = append(observations, o)
+	}
+
+	//Every starting position is possible until the observations rule it out
+	candidates := make([][]bool, len(wheels))
+	for i, w := range wheels {
+		candidates[i] = make([]bool, w.MaxSize)
+		for j := range candidates[i] {
+			candidates[i][j] = true
+		}
+	}
+
+	solutions := searchMessageKeys(wheels, observations, candidates, 2)
+	switch len(solutions) {
+	case 0:
+		return nil, ErrNoMessageKey
+	case 1:
+		return solutions[0], nil
+	}
+	return nil, ErrAmbiguousMessageKey
+}
+
+//searchMessageKeys returns up to limit message keys that are consistent with the observations,
+//considering only the candidate starting positions for each wheel
+func searchMessageKeys(wheels []*Wheel, observations []keyObservation, candidates [][]bool, limit int) []MessageKey {
+	if !pruneMessageKeys(wheels, observations, candidates) {
+		return nil
+	}
+
+	//Find the undecided wheel with the fewest candidates
+	branch := -1
+	fewest := 0
+	for i := range candidates {
+		count := 0
+		for _, ok := range candidates[i] {
+			if ok {
+				count++
+			}
+		}
+		if count > 1 && (branch == -1 || count < fewest) {
+			branch = i
+			fewest = count
+		}
+	}
+
+	//Every wheel has exactly one candidate left
+	if branch == -1 {
+		key := make(MessageKey, len(wheels))
+		for i := range candidates {
+			for start, ok := range candidates[i] {
+				if ok {
+					key[i] = start
+				}
+			}
+		}
+		return []MessageKey{key}
+	}
+
+	solutions := []MessageKey{}
+	for start, ok := range candidates[branch] {
+		if !ok {
+			continue
+		}
+		next := make([][]bool, len(candidates))
+		for i := range candidates {
+			next[i] = append([]bool{}, candidates[i]...)
+		}
+		for other := range next[branch] {
+			next[branch][other] = other == start
+		}
+
+		solutions = append(solutions, searchMessageKeys(wheels, observations, next, limit-len(solutions))...)
+		if len(solutions) >= limit {
+			break
+		}
+	}
+	return solutions
+}
+
+//pruneMessageKeys removes (in place) every candidate starting position that cannot be part of a
+//message key that is consistent with the observations
+//It returns false if some wheel has no candidates left
+func pruneMessageKeys(wheels []*Wheel, observations []keyObservation, candidates [][]bool) bool {
+	for changed := true; changed; {
+		changed = false
+		for _, o := range observations {
+
+			//Find the bits that each wheel could still have at this position
+			var possibleBits [10][2]bool
+			for i, w := range wheels {
+				for start, ok := range candidates[i] {
+					if ok {
+						possibleBits[i][w.Items[(start+o.position)%w.MaxSize]] = true
+					}
+				}
+			}
+
+			//Find the bits that each wheel could have in some setting that is still possible
+			var supportedBits [10][2]bool
+			supported := false
+			for _, setting := range o.allowed {
+				possible := true
+				for i := range wheels {
+					if !possibleBits[i][getNthBit(setting, i)] {
+						possible = false
+						break
+					}
+				}
+				if !possible {
+					continue
+				}
+				supported = true
+				for i := range wheels {
+					supportedBits[i][getNthBit(setting, i)] = true
+				}
+			}
+			if !supported {
+				return false
+			}
+
+			for i, w := range wheels {
+				for start, ok := range candidates[i] {
+					if ok && !supportedBits[i][w.Items[(start+o.position)%w.MaxSize]] {
+						candidates[i][start] = false
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for i := range candidates {
+		remaining := false
+		for _, ok := range candidates[i] {
+			remaining = remaining || ok
+		}
+		if !remaining {
+			return false
+		}
+	}
+	return true
+}
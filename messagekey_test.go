@@ -0,0 +1,129 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_MessageKeys(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintexts := strings.Split(strings.Replace(string(bts), "\r", "", -1), "\n")[:20]
+
+	//Send each message with its own message key
+	rng := rand.New(rand.NewSource(2))
+	keys := []MessageKey{}
+	ciphertexts := []string{}
+	cribs := append([]Crib{}, DEFAULT_CRIBS...)
+	for i, plaintext := range plaintexts {
+		key := make(MessageKey, 10)
+		for j := range key {
+			key[j] = rng.Intn(TEST_CIPHERTEXT_SOLVED_WHEELS[j].MaxSize)
+		}
+		ciphertext, err := EncryptStringWithKey(TEST_CIPHERTEXT_SOLVED_WHEELS, key, plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting message %d: %s", i, err.Error())
+		}
+
+		decrypted, err := DecryptStringWithKey(TEST_CIPHERTEXT_SOLVED_WHEELS, key, ciphertext)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("Message %d did not survive a round trip: %q", i, decrypted)
+		}
+
+		keys = append(keys, key)
+		ciphertexts = append(ciphertexts, ciphertext)
+		cribs = append(cribs, Crib{Text: plaintext[11 : len(plaintext)-2], Offset: 11, Message: i + 1})
+	}
+
+	recovered, err := RecoverMessageKeys(TEST_CIPHERTEXT_SOLVED_WHEELS, strings.NewReader(strings.Join(ciphertexts, "\n")), CrackOptions{Cribs: cribs})
+	if err != nil {
+		t.Fatalf("Error recovering message keys: %s", err.Error())
+	}
+	if len(recovered) != len(keys) {
+		t.Fatalf("Recovered %d message keys, expected %d", len(recovered), len(keys))
+	}
+	for i, key := range keys {
+		for j := range key {
+			if recovered[i][j] != key[j] {
+				t.Errorf("Message %d wheel %d starts at %d, expected %d", i, j, recovered[i][j], key[j])
+			}
+		}
+	}
+
+	//The preamble and sign-off alone are not enough to pin down a message key
+	_, err = RecoverMessageKeys(TEST_CIPHERTEXT_SOLVED_WHEELS, strings.NewReader(ciphertexts[0]), CrackOptions{})
+	var keyErr *MessageKeyError
+	if !errors.As(err, &keyErr) || !errors.Is(err, ErrAmbiguousMessageKey) || keyErr.Line != 1 {
+		t.Errorf("Expected an ambiguous message key for line 1, got %v", err)
+	}
+
+	//The keys of traffic from another network are found through that network
+	network := PermutationNetwork{{1, 3}, {0, 2}, {2, 4}, {0, 1}, {3, 4}}
+	m, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, network)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	ciphertexts = ciphertexts[:0]
+	for i := 0; i < 3; i++ {
+		SetMessageKey(m.Wheels(), keys[i])
+		ciphertext, err := m.Encrypt(plaintexts[i])
+		if err != nil {
+			t.Fatalf("Error encrypting message %d: %s", i, err.Error())
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	ResetWheels(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	recovered, err = RecoverMessageKeys(TEST_CIPHERTEXT_SOLVED_WHEELS, strings.NewReader(strings.Join(ciphertexts, "\n")), CrackOptions{Cribs: cribs, Network: network})
+	if err != nil {
+		t.Fatalf("Error recovering message keys through another network: %s", err.Error())
+	}
+	for i, key := range recovered {
+		if fmt.Sprint(key) != fmt.Sprint(keys[i]) {
+			t.Errorf("Message %d has key %v through another network, expected %v", i, key, keys[i])
+		}
+	}
+
+	//Messages and cribs in another notation give the same keys
+	ita2 := make([]string, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		ita2[i], _ = BLETCHLEY_ALPHABET.Translate(ciphertext, ITA2_ALPHABET)
+	}
+	ita2Cribs := []Crib{}
+	for _, crib := range cribs {
+		crib.Text, _ = BLETCHLEY_ALPHABET.Translate(crib.Text, ITA2_ALPHABET)
+		ita2Cribs = append(ita2Cribs, crib)
+	}
+	recovered, err = RecoverMessageKeys(TEST_CIPHERTEXT_SOLVED_WHEELS, strings.NewReader(strings.Join(ita2, "\n")), CrackOptions{Cribs: ita2Cribs, Network: network, Alphabet: ITA2_ALPHABET})
+	if err != nil {
+		t.Fatalf("Error recovering message keys in ITA2: %s", err.Error())
+	}
+	for i, key := range recovered {
+		if fmt.Sprint(key) != fmt.Sprint(keys[i]) {
+			t.Errorf("Message %d has key %v in ITA2, expected %v", i, key, keys[i])
+		}
+	}
+
+	//Broken wheels are reported, not dereferenced or divided by
+	key := make(MessageKey, 10)
+	for _, broken := range []*Wheel{nil, &Wheel{}} {
+		wheels := append([]*Wheel{}, TEST_CIPHERTEXT_SOLVED_WHEELS...)
+		wheels[3] = broken
+		var invalid *InvalidWheelError
+		if _, err := EncryptStringWithKey(wheels, key, plaintexts[0]); !errors.As(err, &invalid) || invalid.Wheel != 3 {
+			t.Errorf("Expected an invalid wheel 3 encrypting, got %v", err)
+		}
+		if _, err := DecryptStringWithKey(wheels, key, ciphertexts[0]); !errors.As(err, &invalid) || invalid.Wheel != 3 {
+			t.Errorf("Expected an invalid wheel 3 decrypting, got %v", err)
+		}
+		if _, err := RecoverMessageKeys(wheels, strings.NewReader(ciphertexts[0]), CrackOptions{Cribs: cribs}); !errors.As(err, &invalid) || invalid.Wheel != 3 {
+			t.Errorf("Expected an invalid wheel 3 recovering message keys, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package geheimschreiber
+
+import "fmt"
+
+//PermutationNetwork describes how the transpose wheels scramble the bits of each character
+//It is an ordered list of swaps, one for each transpose wheel: if the bit on transpose wheel i is 1,
+//the two bits in swap i (counting from the left, so 0 is the most significant bit) are interchanged
+//The swaps are made in order when encrypting, and in reverse order when decrypting
+//A nil network stands for DEFAULT_NETWORK
+type PermutationNetwork [][2]uint8
+
+//DEFAULT_NETWORK is the permutation network of the machine that sent the test traffic
+var DEFAULT_NETWORK = PermutationNetwork{{0, 4}, {0, 1}, {1, 2}, {2, 3}, {3, 4}}
+
+//Validate checks that the network has one swap for each of the five transpose wheels,
+//and that each swap interchanges two different bits of a character
+func (n PermutationNetwork) Validate() error {
+	if len(n) != 5 {
+		return fmt.Errorf("error: permutation network has %d swaps, expected 5", len(n))
+	}
+	for i, swap := range n {
+		if swap[0] > 4 || swap[1] > 4 {
+			return fmt.Errorf("error: swap %d refers to a bit outside the character", i)
+		}
+		if swap[0] == swap[1] {
+			return fmt.Errorf("error: swap %d interchanges bit %d with itself", i, swap[0])
+		}
+	}
+	return nil
+}
+
+//orDefault returns the network, or DEFAULT_NETWORK if it is nil
+func (n PermutationNetwork) orDefault() PermutationNetwork {
+	if n == nil {
+		return DEFAULT_NETWORK
+	}
+	return n
+}
+
+//encryptWithBits encrypts the integer representation of a character,
+//given the current bit on each of the ten wheels
+func (n PermutationNetwork) encryptWithBits(c int, bits [10]int) int {
+	var i uint8
+	for i = 0; i < 5; i++ {
+		c = (c ^ (bits[i] << (4 - i))) //
+	}
+
+	for i, swap := range n {
+		if bits[5+i] == 1 {
+			c = n.interchange(c, swap)
+		}
+	}
+	return c
+}
+
+//decryptWithBits decrypts the integer representation of a character,
+//given the current bit on each of the ten wheels
+func (n PermutationNetwork) decryptWithBits(c int, bits [10]int) int {
+
+	//Undo the swaps in reverse order
+	for i := len(n) - 1; i >= 0; i-- {
+		if bits[5+i] == 1 {
+			c = n.interchange(c, n[i])
+		}
+	}
+
+	//Order of XOR doesn't matter
+	var i uint8
+	for i = 0; i < 5; i++ {
+		c = (c ^ (bits[i] << (4 - i))) //
+	}
+	return c
+}
+
+//interchange swaps the two bits of c in the given swap, whichever order they are given in
+func (n PermutationNetwork) interchange(c int, swap [2]uint8) int {
+	if swap[0] > swap[1] {
+		return interchangeBits(c, swap[1], swap[0])
+	}
+	return interchangeBits(c, swap[0], swap[1])
+}
+
+//destination returns where the network moves the given bit (counting from the left),
+//when the transpose wheels have the given bits
+func (n PermutationNetwork) destination(bit int, transposeBits [5]int) int {
+	var bits [10]int
+	copy(bits[5:], transposeBits[:])
+
+	//Only the given bit is set, so only it can come out
+	destination, _ := FindUniqueBitIndex(n.encryptWithBits(16>>uint(bit), bits))
+	return destination
+}
+
+//Permutation returns where the network moves each bit of a character (counting from the left), when the bits
+//that control its swaps are given by transpose, the control for the first swap most significant (as in
+//KeystreamCharacter.Transpose)
+func (n PermutationNetwork) Permutation(transpose int) [5]int {
+	n = n.orDefault()
+	var transposeBits [5]int
+	for i := range transposeBits {
+		transposeBits[i] = getNthBit(transpose, 4-i)
+	}
+	var permutation [5]int
+	for bit := range permutation {
+		permutation[bit] = n.destination(bit, transposeBits)
+	}
+	return permutation
+}
+
+//InferenceTable works out what moving a single bit tells us about the transpose wheels
+//table[source][dest] holds, for each transpose wheel, the bit that the wheel must have had if the bit
+//at position source (counting from the left) ended up at position dest, or nil if the move does not
+//determine that wheel; table[source][dest] is nil if the network can never make that move
+func (n PermutationNetwork) InferenceTable() [][][]*int {
+	n = n.orDefault()
+	table := make([][][]*int, 5)
+	for source := range table {
+		table[source] = make([][]*int, 5)
+	}
+
+	//Try every setting of the transpose wheels, and see which settings make each move
+	var seen [5][5]bool
+	var agreed [5][5][5]int
+	var unanimous [5][5][5]bool
+	for setting := 0; setting < 32; setting++ {
+		var transposeBits [5]int
+		for i := range transposeBits {
+			transposeBits[i] = getNthBit(setting, 4-i)
+		}
+		for source := 0; source < 5; source++ {
+			dest := n.destination(source, transposeBits)
+			for i, bit := range transposeBits {
+				if !seen[source][dest] {
+					agreed[source][dest][i] = bit
+					unanimous[source][dest][i] = true
+				} else if agreed[source][dest][i] != bit {
+					unanimous[source][dest][i] = false
+				}
+			}
+			seen[source][dest] = true
+		}
+	}
+
+	for source := range table {
+		for dest := range table[source] {
+			if !seen[source][dest] {
+				continue
+			}
+			table[source][dest] = make([]*int, 5)
+			for i := range table[source][dest] {
+				if unanimous[source][dest][i] {
+					bit := agreed[source][dest][i]
+					table[source][dest][i] = &bit
+				}
+			}
+		}
+	}
+	return table
+}
+
+//TransposeProbs returns, for each bit (counting from the left), the probability that the network
+//moves it to each position, if every setting of the transpose wheels is equally likely
+//For DEFAULT_NETWORK, this is TRANSPOSE_PROBS
+func (n PermutationNetwork) TransposeProbs() [][]float64 {
+	n = n.orDefault()
+	probs := make([][]float64, 5)
+	for i := range probs {
+		probs[i] = make([]float64, 5)
+	}
+	for setting := 0; setting < 32; setting++ {
+		var transposeBits [5]int
+		for i := range transposeBits {
+			transposeBits[i] = getNthBit(setting, 4-i)
+		}
+		for source := range probs {
+			probs[source][n.destination(source, transposeBits)] += 1.0 / 32
+		}
+	}
+	return probs
+}
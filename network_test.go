@@ -0,0 +1,113 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_DefaultNetwork(t *testing.T) {
+
+	probs := DEFAULT_NETWORK.TransposeProbs()
+	for i := range probs {
+		for j := range probs[i] {
+			if probs[i][j] != TRANSPOSE_PROBS[i][j] {
+				t.Errorf("Generated probability %d->%d is %f, expected %f", i, j, probs[i][j], TRANSPOSE_PROBS[i][j])
+			}
+		}
+	}
+
+	//Moving bit 1 to bit 0 can only happen by swapping them with wheel 6
+	table := DEFAULT_NETWORK.InferenceTable()
+	for i, bit := range table[1][0] {
+		if (i == 1) != (bit != nil) || bit != nil && *bit != 1 {
+			t.Errorf("Unexpected inference for wheel %d from 1->0: %v", 5+i, bit)
+		}
+	}
+
+	//Bit 2 cannot get back to bit 0 once wheels 5 and 6 have passed it by
+	if table[2][0] != nil {
+		t.Errorf("Expected the move 2->0 to be impossible")
+	}
+
+	//The generated table must infer everything that the old hand-written one did
+	for source := range TRANSPOSITION_PATTERN {
+		for dest, bits := range TRANSPOSITION_PATTERN[source] {
+			for i, bit := range bits {
+				if bit != nil && (table[source][dest] == nil || table[source][dest][i] == nil || *table[source][dest][i] != *bit) {
+					t.Errorf("Move %d->%d should infer wheel %d is %d", source, dest, 5+i, *bit)
+				}
+			}
+		}
+	}
+}
+
+func Test_InferenceTable(t *testing.T) {
+
+	//Every setting of the transpose wheels must agree with everything the table infers from its moves
+	network := PermutationNetwork{{1, 3}, {0, 2}, {2, 4}, {0, 1}, {3, 4}}
+	table := network.InferenceTable()
+	for setting := 0; setting < 32; setting++ {
+		var transposeBits [5]int
+		for i := range transposeBits {
+			transposeBits[i] = getNthBit(setting, 4-i)
+		}
+		for source := 0; source < 5; source++ {
+			dest := network.destination(source, transposeBits)
+			if table[source][dest] == nil {
+				t.Fatalf("Move %d->%d happens, but the table says it cannot", source, dest)
+			}
+			for i, bit := range table[source][dest] {
+				if bit != nil && *bit != transposeBits[i] {
+					t.Errorf("Move %d->%d infers wheel %d is %d, but it was %d", source, dest, 5+i, *bit, transposeBits[i])
+				}
+			}
+		}
+	}
+}
+
+func Test_ValidateNetwork(t *testing.T) {
+	for _, network := range []PermutationNetwork{
+		{{0, 4}, {0, 1}, {1, 2}, {2, 3}},
+		{{0, 4}, {0, 1}, {1, 2}, {2, 3}, {3, 5}},
+		{{0, 4}, {0, 1}, {1, 1}, {2, 3}, {3, 4}},
+	} {
+		if err := network.Validate(); err == nil {
+			t.Errorf("Expected network %v to be invalid", network)
+		}
+		if _, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, network); err == nil {
+			t.Errorf("Expected a machine with network %v to be invalid", network)
+		}
+	}
+}
+
+func Test_CrackOtherNetwork(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+
+	//Encrypt the test traffic on a machine whose transpose wheels are wired differently
+	network := PermutationNetwork{{3, 4}, {2, 3}, {1, 2}, {0, 1}, {0, 4}}
+	m, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, network)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+	ciphertext, err := m.Encrypt(string(bts))
+	m.Reset()
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	result, err := Crack(strings.NewReader(ciphertext), CrackOptions{Network: network})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	for i, wheel := range result.Wheels {
+		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+			t.Errorf("Wheel %d does not match expected result", i)
+		}
+	}
+}
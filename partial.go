@@ -0,0 +1,254 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"strings"
+)
+
+//PartialWheel holds everything that has been learned about a single wheel,
+//even if there was not enough traffic to learn all of it
+type PartialWheel struct {
+	//Size is the size of the wheel, or 0 if it has not been determined
+	Size int
+
+	//CandidateSizes are the sizes that are still possible for this wheel, in increasing order
+	//Once the size has been determined, this contains only Size
+	CandidateSizes []int
+
+	//Spokes holds the learned value of each spoke, or nil if the spoke is unknown
+	//If Size has not been determined, there is one entry for each time the wheel turned instead
+	//(which, unless the wheels turn irregularly, is one entry per position in the message stream)
+	Spokes []*int
+
+	//Probabilities holds the estimated probability that each spoke is 1
+	//It is only set by CrackStatistical, once the size of the wheel has been determined
+	Probabilities []float64
+
+	//positions holds how far the wheel had turned at each position in the message stream,
+	//or -1 where that is unknown; it is nil if the wheel turns once per character
+	positions []int
+
+	//network and alphabet are those of the machine that sent the traffic, and are the same for every wheel
+	//If nil, DEFAULT_NETWORK and BLETCHLEY_ALPHABET are used
+	network  PermutationNetwork
+	alphabet *Alphabet
+}
+
+//PartialWheels are the ten (possibly incomplete) wheels recovered from a set of messages
+type PartialWheels []*PartialWheel
+
+//Bit returns the value of the spoke that is read at the given position in the message stream,
+//or nil if it is unknown
+func (w *PartialWheel) Bit(position int) *int {
+	spoke := w.spoke(position)
+	if spoke < 0 {
+		return nil
+	}
+	return w.Spokes[spoke]
+}
+
+//spoke returns the index into Spokes of the spoke that is read at the given position in the message stream,
+//or -1 if it is not known which spoke that is
+func (w *PartialWheel) spoke(position int) int {
+	turned := position
+	if w.positions != nil {
+		if position >= len(w.positions) {
+			return -1
+		}
+		turned = w.positions[position]
+	}
+	if turned < 0 {
+		return -1
+	}
+	if w.Size != 0 {
+		return turned % w.Size
+	}
+	if turned < len(w.Spokes) {
+		return turned
+	}
+	return -1
+}
+
+//setPositions records how far each wheel had turned at each position of the message stream,
+//as worked out by streamPositions
+func (p PartialWheels) setPositions(positions [][]int) {
+	if positions == nil {
+		return
+	}
+	for i, w := range p {
+		w.positions = positions[i]
+	}
+}
+
+//setMachine records the permutation network and alphabet of the machine that sent the traffic,
+//so that DecryptString decrypts as that machine would
+func (p PartialWheels) setMachine(network PermutationNetwork, alphabet *Alphabet) {
+	for _, w := range p {
+		w.network = network
+		w.alphabet = alphabet
+	}
+}
+
+//spokeBit returns the value of the spoke that is read once the wheel has turned the given number of times,
+//or nil if it is unknown
+func (w *PartialWheel) spokeBit(turned int) *int {
+	if w.Size != 0 {
+		return w.Spokes[turned%w.Size]
+	}
+	if turned < len(w.Spokes) {
+		return w.Spokes[turned]
+	}
+	return nil
+}
+
+//UnknownSpokes returns the indices of the spokes whose values are unknown
+//If the size of the wheel has not been determined, this returns nil
+func (w *PartialWheel) UnknownSpokes() []int {
+	if w.Size == 0 {
+		return nil
+	}
+	unknown := []int{}
+	for i, spoke := range w.Spokes {
+		if spoke == nil {
+			unknown = append(unknown, i)
+		}
+	}
+	return unknown
+}
+
+//Complete returns true if the size and every spoke of the wheel are known
+func (w *PartialWheel) Complete() bool {
+	return w.Size != 0 && len(w.UnknownSpokes()) == 0
+}
+
+//Complete returns true if every wheel is complete
+func (p PartialWheels) Complete() bool {
+	for _, w := range p {
+		if !w.Complete() {
+			return false
+		}
+	}
+	return true
+}
+
+//Wheels converts the partial wheels into real wheels
+//It returns an InsufficientTrafficError if any wheel is incomplete
+func (p PartialWheels) Wheels() ([]*Wheel, error) {
+	wheels := make([]*Wheel, len(p))
+	for wheelIndex, w := range p {
+		if w.Size == 0 {
+			return nil, &InsufficientTrafficError{Wheel: wheelIndex, Spoke: -1}
+		}
+		items := make([]int, w.Size)
+		for i, spoke := range w.Spokes {
+			if spoke == nil {
+				return nil, &InsufficientTrafficError{Wheel: wheelIndex, Spoke: i}
+			}
+			items[i] = *spoke
+		}
+		wheels[wheelIndex] = NewWheel(items)
+	}
+	return wheels, nil
+}
+
+//WheelOrder gives, for each wheel whose size has been determined, the index into the inventory
+//of the physical wheel that sits in its position, or -1 if the size has not been determined
+//Physical wheels of the same size cannot be told apart, so they are assigned in the order they appear in the inventory
+func (p PartialWheels) WheelOrder(inventory []int) []int {
+	used := make([]bool, len(inventory))
+	order := make([]int, len(p))
+	for i, w := range p {
+		order[i] = -1
+		for j, size := range inventory {
+			if !used[j] && w.Size != 0 && size == w.Size {
+				used[j] = true
+				order[i] = j
+				break
+			}
+		}
+	}
+	return order
+}
+
+//xorMask returns the bits of XOR wheels 0-4 at the given position, if all of them are known
+func (p PartialWheels) xorMask(position int) (mask int, ok bool) {
+	for i := 0; i < 5; i++ {
+		bit := p[i].Bit(position)
+		if bit == nil {
+			return 0, false
+		}
+		mask = mask | *bit<<(4-uint(i))
+	}
+	return mask, true
+}
+
+//DecryptString decrypts a ciphertext that starts at position 0 of the wheels, as DecryptString does,
+//with the permutation network of the machine that sent the traffic and in the alphabet of its messages
+//Any character that cannot be determined from the known spokes is rendered as placeholder
+//A character can still be determined when some spokes are unknown, as long as every possible
+//value of those spokes decrypts it to the same character
+func (p PartialWheels) DecryptString(ciphertext string, placeholder string) (string, error) {
+	if len(p) != 10 {
+		return "", errors.New("error: expected ten wheels")
+	}
+
+	network, alphabet := p[0].network.orDefault(), p[0].alphabet.orDefault()
+	var result strings.Builder
+	position := 0
+	for _, character := range ciphertext {
+
+		char := string(character)
+		if char == "\n" || char == "\r" {
+			result.WriteString(char)
+			continue
+		}
+		c, ok := alphabet.Code(character)
+		if !ok {
+			return "", errors.New("error: character not in alphabet")
+		}
+
+		possible := p.possibleDecryptions(network, position, c)
+		position++
+
+		//The character is only determined if there is exactly one possibility
+		decrypted := -1
+		for d := 0; d < 32; d++ {
+			if possible == 1<<uint(d) {
+				decrypted = d
+			}
+		}
+
+		if decrypted == -1 {
+			result.WriteString(placeholder)
+			continue
+		}
+		result.WriteRune(alphabet.Symbol(decrypted))
+	}
+	return result.String(), nil
+}
+
+//possibleDecryptions returns the set of plaintext integers that the cipher integer c could decrypt to
+//at the given position with the network, for every possible value of the unknown spokes
+//Bit n of the result is set if c could decrypt to n
+func (p PartialWheels) possibleDecryptions(network PermutationNetwork, position int, c int) uint32 {
+	var bits [10]int
+	unknown := []int{}
+	for i, w := range p {
+		bit := w.Bit(position)
+		if bit == nil {
+			unknown = append(unknown, i)
+		} else {
+			bits[i] = *bit
+		}
+	}
+
+	//Try every possible value of the unknown spokes
+	var possible uint32
+	for guess := 0; guess < 1<<uint(len(unknown)); guess++ {
+		for j, i := range unknown {
+			bits[i] = getNthBit(guess, j)
+		}
+		possible = possible | 1<<uint(network.decryptWithBits(c, bits))
+	}
+	return possible
+}
@@ -0,0 +1,124 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_CrackPartial(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	ciphertext := strings.Join(strings.Split(string(bts), "\n")[:300], "\n")
+
+	bts, err = ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintext := strings.Join(strings.Split(string(bts), "\n")[:300], "\n")
+
+	partial, err := CrackPartial(strings.NewReader(ciphertext), CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	if partial.Complete() {
+		t.Fatalf("Expected 300 messages to be too few to learn every wheel")
+	}
+
+	_, err = partial.Wheels()
+	var insufficient *InsufficientTrafficError
+	if !errors.As(err, &insufficient) {
+		t.Errorf("Expected insufficient traffic error, got %v", err)
+	}
+
+	unknownSpokes := 0
+	for i, w := range partial {
+		if w.Size == 0 {
+			t.Errorf("Expected the size of wheel %d to be determined", i)
+			continue
+		}
+		if w.Size != TEST_CIPHERTEXT_SOLVED_WHEELS[i].MaxSize {
+			t.Errorf("Wheel %d has size %d, expected %d", i, w.Size, TEST_CIPHERTEXT_SOLVED_WHEELS[i].MaxSize)
+		}
+		for j, spoke := range w.Spokes {
+			if spoke != nil && *spoke != TEST_CIPHERTEXT_SOLVED_WHEELS[i].Items[j] {
+				t.Errorf("Wheel %d spoke %d was learned incorrectly", i, j)
+			}
+		}
+		unknownSpokes += len(w.UnknownSpokes())
+	}
+	if unknownSpokes == 0 {
+		t.Errorf("Expected some spokes to be unknown")
+	}
+
+	result, err := partial.DecryptString(ciphertext, "-")
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	if len(result) != len(plaintext) {
+		t.Fatalf("Decrypted message has length %d, expected %d", len(result), len(plaintext))
+	}
+	placeholders := 0
+	for i := range result {
+		if result[i] == '-' {
+			placeholders++
+		} else if result[i] != plaintext[i] {
+			t.Fatalf("Decrypted character %d is %q, expected %q", i, result[i], plaintext[i])
+		}
+	}
+	if placeholders == 0 || placeholders == len(result) {
+		t.Errorf("Expected some but not all characters to be decrypted, got %d placeholders", placeholders)
+	}
+}
+
+func Test_PartialDecryptOtherMachine(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintext, err := BLETCHLEY_ALPHABET.Translate(strings.Join(strings.Split(string(bts), "\n")[:300], "\n"), TUNNY_ALPHABET)
+	if err != nil {
+		t.Fatalf("Error translating: %s", err.Error())
+	}
+
+	//The partial wheels must decrypt with the network and alphabet of the traffic, not the defaults
+	network := PermutationNetwork{{3, 4}, {2, 3}, {1, 2}, {0, 1}, {0, 4}}
+	m, err := NewMachineWithNetwork(TEST_CIPHERTEXT_SOLVED_WHEELS, network)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Alphabet = TUNNY_ALPHABET
+	m.Reset()
+	ciphertext, err := m.Encrypt(plaintext)
+	m.Reset()
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	partial, err := CrackPartial(strings.NewReader(ciphertext), CrackOptions{Network: network, Alphabet: TUNNY_ALPHABET})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	result, err := partial.DecryptString(ciphertext, "_")
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	decrypted := 0
+	for i := range result {
+		if result[i] == '_' {
+			continue
+		}
+		decrypted++
+		if result[i] != plaintext[i] {
+			t.Fatalf("Decrypted character %d is %q, expected %q", i, result[i], plaintext[i])
+		}
+	}
+	if decrypted < len(result)/2 {
+		t.Errorf("Only %d of %d characters were decrypted", decrypted, len(result))
+	}
+}
@@ -0,0 +1,263 @@
+package geheimschreiber
+
+import (
+	"io"
+	"math"
+)
+
+//DEFAULT_CONFIDENCE_THRESHOLD is the confidence that CrackStatistical requires before declaring a spoke,
+//unless CrackOptions says otherwise
+var DEFAULT_CONFIDENCE_THRESHOLD = 0.999
+
+//MAX_EVIDENCE bounds the evidence (as a log likelihood ratio) that a single character can give about a spoke,
+//so that a character that seems to determine a spoke can still be outweighed by the rest of the traffic
+var MAX_EVIDENCE = 10.0
+
+//CrackStatistical is like CrackPartial, but it also uses the characters that CrackPartial cannot learn from
+//Every character with known plaintext gives some evidence about the spokes it was encrypted with;
+//The permutation network tells us where each bit is likely to have been moved to if the transpose wheels are unknown
+//Once the evidence for a spoke reaches the confidence threshold, the spoke is declared, which
+//in turn sharpens the evidence for the other spokes
+//The probability that each spoke is 1 is reported in PartialWheel.Probabilities
+func CrackStatistical(r io.Reader, opts CrackOptions) (PartialWheels, error) {
+	if err := validateStepper(opts.Stepper); err != nil {
+		return nil, err
+	}
+
+	cracker := NewIncrementalCracker(opts)
+
+	ciphertext, plaintext, err := parseIntercepts(r, cracker.cribs, cracker.alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cracker.extend(ciphertext, plaintext); err != nil {
+		return nil, err
+	}
+
+	threshold := opts.ConfidenceThreshold
+	if threshold == 0 {
+		threshold = DEFAULT_CONFIDENCE_THRESHOLD
+	}
+
+	wheels := cracker.partialWheels()
+	for _, w := range wheels {
+		if w.Size == 0 {
+			continue
+		}
+		w.Probabilities = make([]float64, w.Size)
+		for i, spoke := range w.Spokes {
+			if spoke == nil {
+				w.Probabilities[i] = 0.5
+			} else {
+				w.Probabilities[i] = float64(*spoke)
+			}
+		}
+	}
+
+	//Learn the XOR wheels first, since we need them to learn anything about the transpose wheels
+	for {
+		//Declaring spokes can tell us where more of the irregularly turning wheels were
+		wheels.setPositions(streamPositions(cracker.stepper, wheels, len(plaintext)))
+
+		declared := declareSpokes(wheels[:5], xorEvidence(cracker.network, wheels, plaintext, ciphertext)[:5], threshold)
+		declared += declareSpokes(wheels[5:], transposeEvidence(cracker.network, wheels, plaintext, ciphertext)[5:], threshold)
+		if declared == 0 {
+			break
+		}
+	}
+	return wheels, nil
+}
+
+//Confidence returns the probability that the given spoke has the value that is most likely for it
+//Spokes learned by CrackPartial have a confidence of 1, and unknown spokes have a confidence of 0.5
+//unless CrackStatistical has found evidence for them
+func (w *PartialWheel) Confidence(spoke int) float64 {
+	if w.Probabilities != nil {
+		return math.Max(w.Probabilities[spoke], 1-w.Probabilities[spoke])
+	}
+	if w.Spokes[spoke] != nil {
+		return 1
+	}
+	return 0.5
+}
+
+//declareSpokes updates the probability of every unknown spoke from the evidence for it,
+//and declares the value of every spoke whose confidence reaches the threshold
+//It returns the number of spokes that were declared
+func declareSpokes(wheels PartialWheels, evidence [][]float64, threshold float64) int {
+	declared := 0
+	for wheelIndex, w := range wheels {
+		if w.Size == 0 {
+			continue
+		}
+		for i, spoke := range w.Spokes {
+			if spoke != nil {
+				continue
+			}
+			w.Probabilities[i] = 1 / (1 + math.Exp(-evidence[wheelIndex][i]))
+
+			bit := -1
+			if w.Probabilities[i] >= threshold {
+				bit = 1
+			} else if 1-w.Probabilities[i] >= threshold {
+				bit = 0
+			}
+			if bit != -1 {
+				w.Spokes[i] = &bit
+				declared++
+			}
+		}
+	}
+	return declared
+}
+
+//boundedEvidence converts the number of ways a spoke could be 1 and 0 into a log likelihood ratio,
+//bounded by MAX_EVIDENCE
+func boundedEvidence(ones, zeros float64) float64 {
+	if zeros == 0 {
+		return MAX_EVIDENCE
+	}
+	if ones == 0 {
+		return -MAX_EVIDENCE
+	}
+	return math.Max(-MAX_EVIDENCE, math.Min(MAX_EVIDENCE, math.Log(ones/zeros)))
+}
+
+//newEvidence creates an empty set of evidence for every wheel whose size has been determined
+func newEvidence(wheels PartialWheels) [][]float64 {
+	evidence := make([][]float64, len(wheels))
+	for i, w := range wheels {
+		evidence[i] = make([]float64, w.Size)
+	}
+	return evidence
+}
+
+//xorEvidence accumulates evidence about the unknown spokes of the XOR wheels (wheels 0-4)
+//from every character with known plaintext
+func xorEvidence(network PermutationNetwork, wheels PartialWheels, plaintext, ciphertext string) [][]float64 {
+	evidence := newEvidence(wheels)
+	transposeProbs := network.TransposeProbs()
+
+	for index, plainRune := range plaintext {
+		plainChar := string(plainRune)
+		if plainChar == "-" {
+			continue
+		}
+		plainInt, _ := BLETCHLEY_ALPHABET.Code(plainRune)
+		cipherInt, _ := BLETCHLEY_ALPHABET.Code(rune(ciphertext[index]))
+
+		//If every transpose spoke is known, we know exactly where each bit ended up
+		destinations, permutationKnown := wheels.bitDestinations(network, index)
+
+		for i := 0; i < 5; i++ {
+			w := wheels[i]
+			spoke := w.spoke(index)
+			if w.Size == 0 || spoke < 0 || w.Spokes[spoke] != nil {
+				continue
+			}
+			plainBit := getNthBit(plainInt, 4-i)
+
+			//The XOR bit is 1 iff the bit that came out of the XOR step differs from the plaintext bit
+			ones := 0.0
+			zeros := 0.0
+			for j := 0; j < 5; j++ {
+				prob := transposeProbs[i][j]
+				if permutationKnown {
+					prob = 0
+					if destinations[i] == j {
+						prob = 1
+					}
+				}
+				if getNthBit(cipherInt, 4-j) != plainBit {
+					ones += prob
+				} else {
+					zeros += prob
+				}
+			}
+			evidence[i][spoke] += boundedEvidence(ones, zeros)
+		}
+	}
+	return evidence
+}
+
+//transposeEvidence accumulates evidence about the unknown spokes of the transpose wheels (wheels 5-9)
+//from every character with known plaintext at which all of the XOR wheels are known
+func transposeEvidence(network PermutationNetwork, wheels PartialWheels, plaintext, ciphertext string) [][]float64 {
+	evidence := newEvidence(wheels)
+
+	for index, plainRune := range plaintext {
+		plainChar := string(plainRune)
+		if plainChar == "-" {
+			continue
+		}
+		plainInt, _ := BLETCHLEY_ALPHABET.Code(plainRune)
+		cipherInt, _ := BLETCHLEY_ALPHABET.Code(rune(ciphertext[index]))
+
+		mask, ok := wheels.xorMask(index)
+		if !ok {
+			continue
+		}
+
+		var bits [10]int
+		unknown := []int{}
+		for i := 5; i < 10; i++ {
+			bit := wheels[i].Bit(index)
+			if bit == nil {
+				unknown = append(unknown, i)
+			} else {
+				bits[i] = *bit
+			}
+		}
+		if len(unknown) == 0 {
+			continue
+		}
+
+		//Count the ways each unknown spoke could be 0 or 1, given the plaintext and ciphertext
+		ones := make([]float64, len(unknown))
+		zeros := make([]float64, len(unknown))
+		for guess := 0; guess < 1<<uint(len(unknown)); guess++ {
+			for j, i := range unknown {
+				bits[i] = getNthBit(guess, j)
+			}
+			if network.encryptWithBits(plainInt^mask, bits) != cipherInt {
+				continue
+			}
+			for j, i := range unknown {
+				if bits[i] == 1 {
+					ones[j]++
+				} else {
+					zeros[j]++
+				}
+			}
+		}
+
+		for j, i := range unknown {
+			w := wheels[i]
+			spoke := w.spoke(index)
+			if w.Size == 0 || spoke < 0 || ones[j]+zeros[j] == 0 {
+				continue
+			}
+			evidence[i][spoke] += boundedEvidence(ones[j], zeros[j])
+		}
+	}
+	return evidence
+}
+
+//bitDestinations returns where each bit is moved to by the transpose wheels at the given position,
+//if all of the transpose wheels are known there
+func (p PartialWheels) bitDestinations(network PermutationNetwork, position int) (destinations [5]int, ok bool) {
+	var transposeBits [5]int
+	for i := range transposeBits {
+		bit := p[5+i].Bit(position)
+		if bit == nil {
+			return destinations, false
+		}
+		transposeBits[i] = *bit
+	}
+
+	for i := range destinations {
+		destinations[i] = network.destination(i, transposeBits)
+	}
+	return destinations, true
+}
@@ -0,0 +1,75 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_CrackStatistical(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	ciphertext := strings.Join(strings.Split(string(bts), "\n")[:100], "\n")
+
+	//One hundred messages are not enough to learn every spoke deterministically...
+	partial, err := CrackPartial(strings.NewReader(ciphertext), CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	if partial.Complete() {
+		t.Fatalf("Expected 100 messages to be too few to learn every wheel deterministically")
+	}
+
+	//...but they are enough to learn them statistically
+	statistical, err := CrackStatistical(strings.NewReader(ciphertext), CrackOptions{})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	wheels, err := statistical.Wheels()
+	if err != nil {
+		t.Fatalf("Error converting wheels: %s", err.Error())
+	}
+	for i, wheel := range wheels {
+		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+			t.Errorf("Wheel %d does not match expected result", i)
+		}
+	}
+
+	for i, w := range statistical {
+		for j := range w.Spokes {
+			if w.Confidence(j) < DEFAULT_CONFIDENCE_THRESHOLD {
+				t.Errorf("Wheel %d spoke %d was declared with confidence %f", i, j, w.Confidence(j))
+			}
+			if partial[i].Spokes[j] != nil && w.Confidence(j) != 1 {
+				t.Errorf("Wheel %d spoke %d was learned deterministically, but has confidence %f", i, j, w.Confidence(j))
+			}
+		}
+	}
+}
+
+func Test_TransposeProbs(t *testing.T) {
+
+	//Try every setting of the transpose wheels, and see where each bit ends up
+	for i := 0; i < 5; i++ {
+		var counts [5]float64
+		for transposeBits := 0; transposeBits < 32; transposeBits++ {
+			var bits [10]int
+			for k := 0; k < 5; k++ {
+				bits[5+k] = getNthBit(transposeBits, 4-k)
+			}
+			j, err := FindUniqueBitIndex(encryptWithBits(16>>uint(i), bits))
+			if err != nil {
+				t.Fatalf("Transposition did not preserve a single bit: %s", err.Error())
+			}
+			counts[j]++
+		}
+		for j := 0; j < 5; j++ {
+			if counts[j]/32 != TRANSPOSE_PROBS[i][j] {
+				t.Errorf("TRANSPOSE_PROBS[%d][%d] is %f, expected %f", i, j, TRANSPOSE_PROBS[i][j], counts[j]/32)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package geheimschreiber
+
+import "fmt"
+
+//Stepper decides how far each wheel turns after each character
+type Stepper interface {
+	//Steps returns how far each wheel turns, given the bit that each wheel read for the character
+	//While cracking, some of the bits may be unknown (nil); Steps returns -1 for any wheel
+	//whose movement depends on a bit that is unknown
+	Steps(bits [10]*int) [10]int
+}
+
+//RegularStepper turns every wheel by one spoke after every character, as on the T52a/b and T52c
+type RegularStepper struct{}
+
+func (RegularStepper) Steps(bits [10]*int) [10]int {
+	var steps [10]int
+	for i := range steps {
+		steps[i] = 1
+	}
+	return steps
+}
+
+//PinControlledStepper turns some wheels only when another wheel reads a 1, as on the T52d and T52e
+type PinControlledStepper struct {
+	//Controllers gives, for each wheel, the position of the wheel whose bit decides whether it turns,
+	//or -1 if it turns after every character
+	Controllers []int
+}
+
+//T52D_STEPPER turns the XOR wheels after every character, and each transpose wheel only when
+//the XOR wheel in the same place in its bank reads a 1
+//This is a representative arrangement of the irregular stepping on the T52d and T52e; substitute
+//the one for the machine that sent the traffic if it is known
+var T52D_STEPPER = &PinControlledStepper{Controllers: []int{-1, -1, -1, -1, -1, 0, 1, 2, 3, 4}}
+
+//Validate checks that there is a controller for each of the ten wheels, and that following
+//the controllers from any wheel always ends at a wheel that turns after every character,
+//so that the machine cannot jam
+func (s *PinControlledStepper) Validate() error {
+	if len(s.Controllers) != 10 {
+		return fmt.Errorf("error: %d controllers, expected 10", len(s.Controllers))
+	}
+	for i := range s.Controllers {
+		wheel := i
+		for steps := 0; s.Controllers[wheel] != -1; steps++ {
+			next := s.Controllers[wheel]
+			if next < -1 || next >= len(s.Controllers) {
+				return fmt.Errorf("error: wheel %d is controlled by wheel %d, which does not exist", wheel, next)
+			}
+			if steps == len(s.Controllers) {
+				return fmt.Errorf("error: wheel %d is controlled by a loop of wheels", i)
+			}
+			wheel = next
+		}
+	}
+	return nil
+}
+
+//Steps returns -1 for a wheel whose controller does not exist, as well as for one whose controller's bit is
+//unknown; Validate rejects such controllers, and the Machine and the cracker call it before stepping
+func (s *PinControlledStepper) Steps(bits [10]*int) [10]int {
+	var steps [10]int
+	for i := range steps {
+		steps[i] = -1
+	}
+	for i, controller := range s.Controllers {
+		switch {
+		case i >= len(steps) || controller < -1 || controller >= len(bits):
+			continue
+		case controller == -1:
+			steps[i] = 1
+		case bits[controller] == nil:
+			steps[i] = -1
+		default:
+			steps[i] = *bits[controller]
+		}
+	}
+	return steps
+}
+
+//validateStepper checks the stepper if it is a PinControlledStepper, as Variant.Validate does
+//Other steppers are assumed to be valid
+func validateStepper(stepper Stepper) error {
+	if s, ok := stepper.(*PinControlledStepper); ok {
+		return s.Validate()
+	}
+	return nil
+}
+
+//streamPositions works out how far each wheel had turned at each position of the message stream
+//positions[i][p] is the number of spokes wheel i had turned by position p, or -1 if that depends
+//on a spoke that is unknown; once a wheel's position is lost, it stays lost for the rest of the stream
+//It returns nil if the wheels turn regularly, in which case every wheel had turned p spokes at position p
+func streamPositions(stepper Stepper, wheels PartialWheels, length int) [][]int {
+	if stepper == nil {
+		return nil
+	}
+	if _, ok := stepper.(RegularStepper); ok {
+		return nil
+	}
+
+	positions := make([][]int, len(wheels))
+	for i := range positions {
+		positions[i] = make([]int, length)
+	}
+
+	var turned [10]int
+	for p := 0; p < length; p++ {
+		var bits [10]*int
+		for i, w := range wheels {
+			positions[i][p] = turned[i]
+			if turned[i] >= 0 {
+				bits[i] = w.spokeBit(turned[i])
+			}
+		}
+
+		steps := stepper.Steps(bits)
+		for i := range turned {
+			if turned[i] < 0 || steps[i] < 0 {
+				turned[i] = -1
+			} else {
+				turned[i] += steps[i]
+			}
+		}
+	}
+	return positions
+}
+
+//streamStep returns how far the wheel had turned at the given position of the message stream,
+//or -1 if it is unknown
+func streamStep(positions [][]int, wheelIndex, position int) int {
+	if positions == nil {
+		return position
+	}
+	return positions[wheelIndex][position]
+}
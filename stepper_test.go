@@ -0,0 +1,117 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_PinControlledStepper(t *testing.T) {
+
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Stepper = T52D_STEPPER
+	m.Reset()
+
+	//Wheel 5 only turns when wheel 0 reads a 1
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35"
+	ones := 0
+	for i := range plaintext {
+		ones += TEST_CIPHERTEXT_SOLVED_WHEELS[0].Items[i]
+	}
+
+	ciphertext, err := m.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	if m.XORWheels[0].CurrentIndex != len(plaintext) {
+		t.Errorf("Wheel 0 turned %d times, expected %d", m.XORWheels[0].CurrentIndex, len(plaintext))
+	}
+	if m.TransposeWheels[0].CurrentIndex != ones {
+		t.Errorf("Wheel 5 turned %d times, expected %d", m.TransposeWheels[0].CurrentIndex, ones)
+	}
+
+	m.Reset()
+	decrypted, err := m.Decrypt(ciphertext)
+	if err != nil || decrypted != plaintext {
+		t.Errorf("Message did not survive a round trip: %q", decrypted)
+	}
+	m.Reset()
+
+	for _, controllers := range [][]int{
+		{-1, -1, -1, -1, -1, 0, 1, 2, 3},
+		{-1, -1, -1, -1, -1, 6, 5, 2, 3, 4},
+		{-1, -1, -1, -1, -1, 0, 1, 2, 3, 10},
+	} {
+		s := &PinControlledStepper{Controllers: controllers}
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected controllers %v to be invalid", controllers)
+		}
+	}
+
+	//A stepper that was never validated is reported, not indexed out of range
+	broken := &PinControlledStepper{Controllers: []int{-1, -1, -1, -1, -1, 0, 1, 2, 3, 10}}
+	one := 1
+	if steps := broken.Steps([10]*int{&one, &one, &one, &one, &one, &one, &one, &one, &one, &one}); steps[9] != -1 || steps[5] != 1 {
+		t.Errorf("Expected wheel 9 to have no step and wheel 5 to turn, got %v", steps)
+	}
+	m.Stepper = broken
+	if _, err := m.Encrypt(plaintext); err == nil {
+		t.Errorf("Expected an error encrypting with an invalid stepper")
+	}
+	if _, err := m.DecryptSymbols([]uint8{1, 2, 3}); err == nil {
+		t.Errorf("Expected an error decrypting symbols with an invalid stepper")
+	}
+	if _, err := Crack(strings.NewReader(ciphertext), CrackOptions{Stepper: broken}); err == nil {
+		t.Errorf("Expected an error cracking with an invalid stepper")
+	}
+	if err := NewIncrementalCracker(CrackOptions{Stepper: broken}).AddMessage(ciphertext); err == nil {
+		t.Errorf("Expected an error adding a message with an invalid stepper")
+	}
+	m.Reset()
+
+	if streamPositions(RegularStepper{}, nil, 10) != nil {
+		t.Errorf("Expected regular stepping not to need positions")
+	}
+}
+
+func Test_CrackIrregularStepping(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Stepper = T52D_STEPPER
+	m.Reset()
+	ciphertext, err := m.Encrypt(string(bts))
+	m.Reset()
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	//Assuming that the wheels turn regularly gets nowhere near the answer
+	if result, err := Crack(strings.NewReader(ciphertext), CrackOptions{}); err == nil {
+		for i, wheel := range result.Wheels {
+			if i >= 5 && wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+				t.Errorf("Wheel %d was recovered without knowing how the wheels turn", i)
+			}
+		}
+	}
+
+	result, err := Crack(strings.NewReader(ciphertext), CrackOptions{Stepper: T52D_STEPPER})
+	if err != nil {
+		t.Fatalf("Error cracking ciphertext: %s", err.Error())
+	}
+	for i, wheel := range result.Wheels {
+		if !wheel.Equals(*TEST_CIPHERTEXT_SOLVED_WHEELS[i]) {
+			t.Errorf("Wheel %d does not match expected result", i)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+//STREAM_BUFFER_SIZE is the number of bytes a decrypting reader reads from its source at a time
+var STREAM_BUFFER_SIZE = 4096
+
+//streamCoder encrypts or decrypts a stream of bytes with a Machine, a piece at a time
+//A character whose bytes are split between pieces is held back until the rest of it arrives
+type streamCoder struct {
+	m       *Machine
+	encrypt bool
+
+	//partial holds the first bytes of a character that was split
+	partial []byte
+}
+
+//process appends the encryption or decryption of the piece to dst, passing line breaks through unchanged
+//It returns the new dst, and the number of bytes of the piece that were used; if that is less than the whole
+//piece, the error says why
+func (s *streamCoder) process(dst, piece []byte) ([]byte, int, error) {
+	start := -len(s.partial)
+	text := append(s.partial, piece...)
+	s.partial = nil
+	for len(text) > 0 {
+		if !utf8.FullRune(text) {
+			s.partial = append([]byte{}, text...)
+			break
+		}
+		character, size := utf8.DecodeRune(text)
+		if character == '\n' || character == '\r' {
+			dst = append(dst, text[:size]...)
+		} else {
+			var out string
+			var err error
+			if s.encrypt {
+				out, err = s.m.encryptCharacter(character)
+			} else {
+				out, err = s.m.decryptCharacter(character)
+			}
+			if err != nil {
+				if start < 0 {
+					start = 0
+				}
+				return dst, start, err
+			}
+			dst = append(dst, out...)
+		}
+		text = text[size:]
+		start += size
+	}
+	return dst, len(piece), nil
+}
+
+//encryptWriter encrypts everything written to it, and writes the ciphertext on to w
+type encryptWriter struct {
+	w     io.Writer
+	coder streamCoder
+	out   []byte
+
+	//err is the error that stopped the encryption, if any
+	err error
+}
+
+//NewEncryptWriter returns a writer that encrypts everything written to it with the Machine, continuing from the
+//current position of the wheels, and writes the ciphertext to w
+//Line breaks are passed through unchanged, and do not turn the wheels. The ciphertext of each write is written
+//before Write returns, except that a character split between two writes is held back until the rest of it arrives
+//Close must be called once the plaintext has all been written, to check that it did not end partway through a
+//character; it does not close w
+//If a character is not in the Machine's alphabet, or the ciphertext cannot be written, nothing after it is
+//encrypted, and every later Write fails
+func NewEncryptWriter(w io.Writer, m *Machine) io.WriteCloser {
+	return &encryptWriter{w: w, coder: streamCoder{m: m, encrypt: true}}
+}
+
+//Write encrypts p, and returns the number of bytes of p that were encrypted (or held back as part of a split
+//character); the wheels have turned once for each character among them, even if writing the ciphertext failed
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	out, n, err := e.coder.process(e.out[:0], p)
+	e.out = out[:0]
+	e.err = err
+	if _, writeErr := e.w.Write(out); writeErr != nil {
+		e.err = writeErr
+		return n, writeErr
+	}
+	return n, err
+}
+
+//Close returns an error if the plaintext ended partway through a character, or the error that stopped the encryption
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.coder.partial) > 0 {
+		return errors.New("error: plaintext ends partway through a character")
+	}
+	return nil
+}
+
+//decryptReader decrypts everything read from r
+type decryptReader struct {
+	r     io.Reader
+	coder streamCoder
+	in    []byte
+
+	//out holds the plaintext that has not yet been read, from position next onwards
+	out  []byte
+	next int
+
+	err error
+}
+
+//NewDecryptReader returns a reader that reads ciphertext from r and decrypts it with the Machine, continuing from
+//the current position of the wheels
+//Line breaks are passed through unchanged, and do not turn the wheels. At most STREAM_BUFFER_SIZE bytes of
+//ciphertext are read from r at a time, so a stream of any length can be decrypted
+//If a character is not in the Machine's alphabet, the plaintext before it is returned, and then the error
+func NewDecryptReader(r io.Reader, m *Machine) io.Reader {
+	return &decryptReader{r: r, coder: streamCoder{m: m, encrypt: false}, in: make([]byte, STREAM_BUFFER_SIZE)}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for d.next == len(d.out) {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		n, err := d.r.Read(d.in)
+		out, _, processErr := d.coder.process(d.out[:0], d.in[:n])
+		d.out, d.next = out, 0
+		switch {
+		case processErr != nil:
+			d.err = processErr
+		case err == io.EOF && len(d.coder.partial) > 0:
+			d.err = errors.New("error: ciphertext ends partway through a character")
+		default:
+			d.err = err
+		}
+	}
+
+	n := copy(p, d.out[d.next:])
+	d.next += n
+	return n, nil
+}
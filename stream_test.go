@@ -0,0 +1,148 @@
+package geheimschreiber
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func Test_EncryptWriter(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+	expected, err := m.Encrypt(string(bts))
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	m.Reset()
+	var ciphertext bytes.Buffer
+	w := NewEncryptWriter(&ciphertext, m)
+	for i := 0; i < len(bts); i += 7 {
+		end := i + 7
+		if end > len(bts) {
+			end = len(bts)
+		}
+		if n, err := w.Write(bts[i:end]); err != nil || n != end-i {
+			t.Fatalf("Wrote %d of %d bytes: %v", n, end-i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Error closing: %s", err.Error())
+	}
+	if ciphertext.String() != expected {
+		t.Errorf("Streamed ciphertext does not match Encrypt")
+	}
+
+	//A character that is not in the alphabet stops the encryption
+	m.Reset()
+	expected, _ = m.Encrypt("KING4HENRY")
+	m.Reset()
+	ciphertext.Reset()
+	w = NewEncryptWriter(&ciphertext, m)
+	if n, err := w.Write([]byte("KING4HENRY!IV")); err == nil || n != 10 {
+		t.Errorf("Wrote %d bytes with error %v, expected 10 bytes and an error", n, err)
+	}
+	if ciphertext.String() != expected {
+		t.Errorf("Encrypted %q before the error, expected %q", ciphertext.String(), expected)
+	}
+	if n, err := w.Write([]byte("IV")); err == nil || n != 0 {
+		t.Errorf("Wrote %d bytes with error %v after the encryption stopped", n, err)
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("Expected an error closing after the encryption stopped")
+	}
+
+	//Plaintext must not end partway through a character
+	m.Reset()
+	m.Alphabet = ITA2_ALPHABET
+	w = NewEncryptWriter(ioutil.Discard, m)
+	if n, err := w.Write([]byte("KING␠"[:6])); err != nil || n != 6 {
+		t.Errorf("Wrote %d bytes with error %v, expected 6 bytes", n, err)
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("Expected an error for plaintext that ends partway through a character")
+	}
+	m.Alphabet = nil
+
+	//If the ciphertext cannot be written, the bytes that turned the wheels are still counted
+	m.Reset()
+	w = NewEncryptWriter(failingWriter{}, m)
+	if n, err := w.Write([]byte("KING4HENRY")); err != errWriteFailed || n != 10 {
+		t.Errorf("Wrote %d bytes with error %v, expected 10 bytes and the write error", n, err)
+	}
+	m.Reset()
+}
+
+var errWriteFailed = errors.New("error: write failed")
+
+//failingWriter is a writer that always fails
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func Test_DecryptReader(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_CIPHERTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+	expected, err := m.Decrypt(string(bts))
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+
+	m.Reset()
+	plaintext, err := ioutil.ReadAll(NewDecryptReader(bytes.NewReader(bts), m))
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	if string(plaintext) != expected {
+		t.Errorf("Streamed plaintext does not match Decrypt")
+	}
+
+	//Characters of more than one byte may be split between reads
+	m.Reset()
+	m.Alphabet = ITA2_ALPHABET
+	ciphertext, err := BLETCHLEY_ALPHABET.Translate(string(bts), ITA2_ALPHABET)
+	if err != nil {
+		t.Fatalf("Error translating: %s", err.Error())
+	}
+	plaintext, err = ioutil.ReadAll(NewDecryptReader(iotest.OneByteReader(strings.NewReader(ciphertext)), m))
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	if translated, _ := ITA2_ALPHABET.Translate(string(plaintext), BLETCHLEY_ALPHABET); translated != expected {
+		t.Errorf("Streamed plaintext does not match Decrypt")
+	}
+
+	m.Reset()
+	if _, err := ioutil.ReadAll(NewDecryptReader(strings.NewReader("KING␠"[:6]), m)); err == nil {
+		t.Errorf("Expected an error for ciphertext that ends partway through a character")
+	}
+
+	m.Alphabet = nil
+	m.Reset()
+	plaintext, err = ioutil.ReadAll(NewDecryptReader(strings.NewReader(string(bts[:10])+"!"), m))
+	if err == nil || string(plaintext) != expected[:10] {
+		t.Errorf("Read %q with error %v, expected %q and an error", plaintext, err, expected[:10])
+	}
+	m.Reset()
+}
@@ -0,0 +1,129 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"fmt"
+)
+
+//The symbol API works on messages as 5-bit symbols (0-31) rather than as characters, with impulse 1 as the
+//most significant bit; Alphabet.Symbols and Alphabet.Text convert between the two
+//A message of symbols has no line breaks, since they do not turn the wheels
+
+//Symbols converts text to symbols, skipping line breaks
+//It returns an error if any other character is not in the alphabet
+func (a *Alphabet) Symbols(text string) ([]uint8, error) {
+	symbols := make([]uint8, 0, len(text))
+	for _, character := range text {
+		if character == '\n' || character == '\r' {
+			continue
+		}
+		code, ok := a.Code(character)
+		if !ok {
+			return nil, fmt.Errorf("error: character %q not in alphabet", character)
+		}
+		symbols = append(symbols, uint8(code))
+	}
+	return symbols, nil
+}
+
+//Text converts symbols to text
+//It returns an error if a symbol is not 0-31
+func (a *Alphabet) Text(symbols []uint8) (string, error) {
+	if err := validateSymbols(symbols); err != nil {
+		return "", err
+	}
+	text := make([]rune, len(symbols))
+	for i, symbol := range symbols {
+		text[i] = a.Symbol(int(symbol))
+	}
+	return string(text), nil
+}
+
+//validateSymbols checks that every symbol is 0-31
+func validateSymbols(symbols []uint8) error {
+	for i, symbol := range symbols {
+		if symbol > 31 {
+			return fmt.Errorf("error: symbol %d at position %d is not 0-31", symbol, i)
+		}
+	}
+	return nil
+}
+
+//EncryptSymbols encrypts the plaintext symbols, continuing from the current position of the wheels
+//It returns an error, without turning the wheels, if a symbol is not 0-31 or the stepper is not valid
+func (m *Machine) EncryptSymbols(plaintext []uint8) ([]uint8, error) {
+	if err := validateSymbols(plaintext); err != nil {
+		return nil, err
+	}
+	if err := validateStepper(m.Stepper); err != nil {
+		return nil, err
+	}
+	ciphertext := make([]uint8, len(plaintext))
+	for i, symbol := range plaintext {
+		ciphertext[i] = m.encryptSymbol(symbol)
+	}
+	return ciphertext, nil
+}
+
+//DecryptSymbols decrypts the ciphertext symbols, continuing from the current position of the wheels
+//It returns an error, without turning the wheels, if a symbol is not 0-31 or the stepper is not valid
+func (m *Machine) DecryptSymbols(ciphertext []uint8) ([]uint8, error) {
+	if err := validateSymbols(ciphertext); err != nil {
+		return nil, err
+	}
+	if err := validateStepper(m.Stepper); err != nil {
+		return nil, err
+	}
+	plaintext := make([]uint8, len(ciphertext))
+	for i, symbol := range ciphertext {
+		plaintext[i] = m.decryptSymbol(symbol)
+	}
+	return plaintext, nil
+}
+
+//encryptSymbol encrypts a single symbol, and turns every wheel forward
+func (m *Machine) encryptSymbol(symbol uint8) uint8 {
+	return uint8(m.Network.orDefault().encryptWithBits(int(symbol), m.currentBits()))
+}
+
+//decryptSymbol decrypts a single symbol, and turns every wheel forward
+func (m *Machine) decryptSymbol(symbol uint8) uint8 {
+	return uint8(m.Network.orDefault().decryptWithBits(int(symbol), m.currentBits()))
+}
+
+//EncryptSymbols encrypts the plaintext symbols, continuing from the current position of the wheels
+//It returns an error, without turning the wheels, if a symbol is not 0-31
+func (l *Lorenz) EncryptSymbols(plaintext []uint8) ([]uint8, error) {
+	return l.processSymbols(plaintext, true)
+}
+
+//DecryptSymbols decrypts the ciphertext symbols, continuing from the current position of the wheels
+//It returns an error, without turning the wheels, if a symbol is not 0-31
+func (l *Lorenz) DecryptSymbols(ciphertext []uint8) ([]uint8, error) {
+	return l.processSymbols(ciphertext, false)
+}
+
+func (l *Lorenz) processSymbols(symbols []uint8, encrypt bool) ([]uint8, error) {
+	if err := validateSymbols(symbols); err != nil {
+		return nil, err
+	}
+	out := make([]uint8, len(symbols))
+	for i, symbol := range symbols {
+		out[i] = l.processSymbol(symbol, encrypt)
+	}
+	return out, nil
+}
+
+//Keystream returns the next n symbols of the keystream (the chi and psi wheels XORed together), which are XORed
+//into the plaintext to encrypt it, and turns the wheels as if n characters had been encrypted
+//With the P5 limitation the keystream depends on the plaintext, so it returns an error
+func (l *Lorenz) Keystream(n int) ([]uint8, error) {
+	if l.Limitation.P5 {
+		return nil, errors.New("error: the keystream depends on the plaintext with the P5 limitation")
+	}
+	keystream := make([]uint8, n)
+	for i := range keystream {
+		keystream[i] = l.processSymbol(0, true)
+	}
+	return keystream, nil
+}
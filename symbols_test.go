@@ -0,0 +1,108 @@
+package geheimschreiber
+
+import (
+	"testing"
+)
+
+func Test_Symbols(t *testing.T) {
+
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35\nUMUM4VEVE35SO4SHAKEN4AS4WE4ARE35"
+	symbols, err := BLETCHLEY_ALPHABET.Symbols(plaintext)
+	if err != nil {
+		t.Fatalf("Error converting to symbols: %s", err.Error())
+	}
+	if len(symbols) != len(plaintext)-1 || symbols[0] != 28 || symbols[4] != 4 {
+		t.Errorf("Converted to %v", symbols)
+	}
+
+	m, err := NewMachine(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating machine: %s", err.Error())
+	}
+	m.Reset()
+	expected, err := m.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	m.Reset()
+	ciphertext, err := m.EncryptSymbols(symbols)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	text, err := BLETCHLEY_ALPHABET.Text(ciphertext)
+	if err != nil {
+		t.Fatalf("Error converting to text: %s", err.Error())
+	}
+	if text != expected[:26]+expected[27:] {
+		t.Errorf("Encrypted symbols to %q, expected %q", text, expected)
+	}
+
+	m.Reset()
+	decrypted, err := m.DecryptSymbols(ciphertext)
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	for i := range decrypted {
+		if decrypted[i] != symbols[i] {
+			t.Fatalf("Symbol %d decrypted to %d, expected %d", i, decrypted[i], symbols[i])
+		}
+	}
+
+	//An invalid symbol is reported without turning the wheels
+	m.Reset()
+	if _, err := m.EncryptSymbols([]uint8{1, 2, 32}); err == nil {
+		t.Errorf("Expected an error encrypting a symbol that is not 0-31")
+	}
+	if m.XORWheels[0].CurrentIndex != 0 {
+		t.Errorf("Wheels turned for an invalid message")
+	}
+	if _, err := BLETCHLEY_ALPHABET.Text([]uint8{40}); err == nil {
+		t.Errorf("Expected an error converting a symbol that is not 0-31")
+	}
+	if _, err := BLETCHLEY_ALPHABET.Symbols("KING!"); err == nil {
+		t.Errorf("Expected an error converting a character that is not in the alphabet")
+	}
+	m.Reset()
+}
+
+func Test_LorenzSymbols(t *testing.T) {
+
+	chi, psi, motor := lorenzTestWheels(1)
+	l, err := NewLorenz(chi, psi, motor, SZ42A)
+	if err != nil {
+		t.Fatalf("Error creating Lorenz: %s", err.Error())
+	}
+	symbols, _ := BLETCHLEY_ALPHABET.Symbols("UMUM4VEVE35KING4HENRY4IV35")
+
+	ciphertext, err := l.EncryptSymbols(symbols)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	l.Reset()
+	keystream, err := l.Keystream(len(symbols))
+	if err != nil {
+		t.Fatalf("Error generating keystream: %s", err.Error())
+	}
+	for i := range symbols {
+		if symbols[i]^keystream[i] != ciphertext[i] {
+			t.Errorf("Keystream at position %d does not encipher the plaintext", i)
+		}
+	}
+
+	l.Reset()
+	decrypted, err := l.DecryptSymbols(ciphertext)
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err.Error())
+	}
+	for i := range decrypted {
+		if decrypted[i] != symbols[i] {
+			t.Errorf("Symbol %d decrypted to %d, expected %d", i, decrypted[i], symbols[i])
+		}
+	}
+
+	l.Limitation = Limitation{Chi2: true, P5: true}
+	if _, err := l.Keystream(10); err == nil {
+		t.Errorf("Expected an error generating a keystream with the P5 limitation")
+	}
+}
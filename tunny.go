@@ -0,0 +1,426 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+//ChiScore is the score of one setting of some chi wheels in a Colossus run
+type ChiScore struct {
+	//Setting holds the starting position of each chi wheel in the run
+	Setting []int
+
+	//Agreements is how many times the run's delta stream was a dot, out of Compared
+	Agreements int
+	Compared   int
+
+	//Sigma is how many standard deviations Agreements is above what a wrong setting would give
+	Sigma float64
+}
+
+//LorenzSetting is the setting of every wheel of a Lorenz, recovered from a single message
+type LorenzSetting struct {
+	//Key holds the starting position of each wheel, in the order of Lorenz.Wheels
+	Key MessageKey
+
+	//ChiSigma holds the score of each chi wheel's setting, in standard deviations
+	ChiSigma [5]float64
+}
+
+//RunChi12 is the Colossus "1+2 run": for every setting of chi wheels 1 and 2, it counts how often
+//ΔZ1⊕ΔZ2⊕Δχ1⊕Δχ2 is a dot, where Z is the ciphertext and Δ is the XOR of adjacent characters
+//At the right setting that is ΔD1⊕ΔD2 (D being the ciphertext with the chi removed), which is
+//biased whenever the psi wheels stand still, because the plaintext's deltas are biased
+//The wheel patterns are taken from l, ignoring their current positions
+//It returns the top scoring settings, best first; as on Colossus, the settings with the most dots score highest
+func RunChi12(ciphertext string, l *Lorenz, top int) ([]ChiScore, error) {
+	scores, err := chiPairScores(ciphertext, l, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Sigma > scores[j].Sigma })
+	return topChiScores(scores, top), nil
+}
+
+//RunChiPair is like RunChi12, but for chi wheels a and b (counting from 0)
+//The plaintext's deltas may be biased towards crosses rather than dots for some pairs of impulses
+//(for English, impulses 3 and 4 are), so settings are ranked by the size of Sigma, whatever its sign
+func RunChiPair(ciphertext string, l *Lorenz, a, b int, top int) ([]ChiScore, error) {
+	scores, err := chiPairScores(ciphertext, l, a, b)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return math.Abs(scores[i].Sigma) > math.Abs(scores[j].Sigma) })
+	return topChiScores(scores, top), nil
+}
+
+//chiPairScores scores every setting of chi wheels a and b, in order of the setting
+func chiPairScores(ciphertext string, l *Lorenz, a, b int) ([]ChiScore, error) {
+	if a < 0 || b < 0 || a >= len(l.Chi) || b >= len(l.Chi) || a == b {
+		return nil, errors.New("error: a chi run needs two different chi wheels")
+	}
+	cipherInts, err := lorenzCiphertext(ciphertext, l.Alphabet.orDefault())
+	if err != nil {
+		return nil, err
+	}
+	deltas := deltaStream(cipherInts)
+	deChiA := deChiDeltas(deltas, l.Chi[a], a)
+	deChiB := deChiDeltas(deltas, l.Chi[b], b)
+
+	scores := []ChiScore{}
+	for sa, bitsA := range deChiA {
+		for sb, bitsB := range deChiB {
+			agreements := 0
+			for i := range bitsA {
+				if bitsA[i] == bitsB[i] {
+					agreements++
+				}
+			}
+			scores = append(scores, newChiScore([]int{sa, sb}, agreements, len(deltas)))
+		}
+	}
+	return scores, nil
+}
+
+//topChiScores returns the first top of the ranked scores
+func topChiScores(scores []ChiScore, top int) []ChiScore {
+	if top < len(scores) {
+		scores = scores[:top]
+	}
+	return scores
+}
+
+//SetLorenz recovers the starting position of every wheel for a single message, given the wheel patterns in l
+//and a model of the plaintext language with N of at least 2
+//First the chi wheels are set. The model predicts how biased the plaintext's delta is on each impulse and each
+//pair of impulses; the two chi wheels on the most biased pair are set together, and then each of the others
+//in turn, by counting agreements on every impulse and pair of impulses that involves it, weighted by their bias
+//Then, for every setting of the motor wheels, each psi wheel is set by scoring the bits of the de-chi'd
+//ciphertext against the model's letter frequencies, and the motor setting with the best total score wins
+//Setting the motor wheels needs the limitation to be known before the psi wheels are, so a limitation
+//on psi wheel 1 or on the plaintext is not supported
+func SetLorenz(ciphertext string, l *Lorenz, model *NgramModel) (*LorenzSetting, error) {
+	if model == nil {
+		return nil, errors.New("error: a language model is required to set the wheels")
+	}
+	if model.N < 2 {
+		return nil, errors.New("error: setting the chi wheels needs a model of at least bigrams")
+	}
+	if l.Limitation.Psi1 || l.Limitation.P5 {
+		return nil, errors.New("error: cannot set the motor wheels with a limitation on psi 1 or the plaintext")
+	}
+	cipherInts, err := lorenzCiphertext(ciphertext, l.Alphabet.orDefault())
+	if err != nil {
+		return nil, err
+	}
+
+	setting := &LorenzSetting{Key: make(MessageKey, 12)}
+	setting.ChiSigma = setChiWheels(cipherInts, l.Chi, deltaBiases(model), setting.Key[:5])
+
+	deChi := make([]int, len(cipherInts))
+	for i, c := range cipherInts {
+		deChi[i] = c ^ wheelCharacterAt(l.Chi, setting.Key[:5], i)
+	}
+
+	bitLogProbs := impulseLogProbs(model)
+	bestScore := math.Inf(-1)
+	for m61 := 0; m61 < l.Motor[0].MaxSize; m61++ {
+		for m37 := 0; m37 < l.Motor[1].MaxSize; m37++ {
+			steps := l.psiSteps(m61, m37, setting.Key[1], len(deChi))
+			score := 0.0
+			var psiSetting [5]int
+			for k, w := range l.Psi {
+				s, wheelScore := setPsi(deChi, steps, w, k, bitLogProbs[k])
+				psiSetting[k] = s
+				score += wheelScore
+			}
+			if score > bestScore {
+				bestScore = score
+				copy(setting.Key[5:10], psiSetting[:])
+				setting.Key[10], setting.Key[11] = m61, m37
+			}
+		}
+	}
+	return setting, nil
+}
+
+//SetMessageKey turns the wheels to the starting positions in the key, in the order of Wheels,
+//and forgets the earlier characters
+func (l *Lorenz) SetMessageKey(key MessageKey) error {
+	if err := SetMessageKey(l.Wheels(), key); err != nil {
+		return err
+	}
+	l.chi2Back = 0
+	l.psi1Back = 0
+	l.p5Back = [2]int{}
+	return nil
+}
+
+//lorenzCiphertext converts a message to integers, dropping the line breaks (which do not turn the wheels)
+func lorenzCiphertext(ciphertext string, alphabet *Alphabet) ([]int, error) {
+	symbols, err := alphabet.Symbols(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(symbols) < 2 {
+		return nil, errors.New("error: message too short to set the wheels")
+	}
+	ints := make([]int, len(symbols))
+	for i, symbol := range symbols {
+		ints[i] = int(symbol)
+	}
+	return ints, nil
+}
+
+//deltaStream returns the XOR of each character with the one after it
+func deltaStream(ints []int) []int {
+	deltas := make([]int, len(ints)-1)
+	for i := range deltas {
+		deltas[i] = ints[i] ^ ints[i+1]
+	}
+	return deltas
+}
+
+//impulse returns impulse k (counting from 0) of a character, impulse 0 being the most significant bit
+func impulse(c, k int) int {
+	return getNthBit(c, 4-k)
+}
+
+//wheelBit returns the bit of the wheel at the given position, which may be past the end of the wheel
+func wheelBit(w *Wheel, position int) int {
+	return w.Items[position%w.MaxSize]
+}
+
+//deltaBit returns the XOR of the bits of the wheel at the given position and the one after it
+func deltaBit(w *Wheel, position int) int {
+	return wheelBit(w, position) ^ wheelBit(w, position+1)
+}
+
+//wheelCharacterAt returns the bits of five wheels at the given offset from their starting positions,
+//the first wheel most significant
+func wheelCharacterAt(wheels []*Wheel, start []int, offset int) int {
+	c := 0
+	for k, w := range wheels {
+		c = c<<1 | wheelBit(w, start[k]+offset)
+	}
+	return c
+}
+
+//deChiDeltas returns, for every setting of chi wheel k, impulse k of the delta stream with the chi's delta removed
+func deChiDeltas(deltas []int, w *Wheel, k int) [][]int {
+	bits := make([][]int, w.MaxSize)
+	for s := range bits {
+		bits[s] = make([]int, len(deltas))
+		for i, d := range deltas {
+			bits[s][i] = impulse(d, k) ^ deltaBit(w, s+i)
+		}
+	}
+	return bits
+}
+
+//newChiScore scores a count of agreements against the half that a wrong setting would give
+func newChiScore(setting []int, agreements, compared int) ChiScore {
+	mean := float64(compared) / 2
+	sigma := (float64(agreements) - mean) / math.Sqrt(float64(compared)/4)
+	return ChiScore{Setting: setting, Agreements: agreements, Compared: compared, Sigma: sigma}
+}
+
+//deltaBiases returns, for every set of impulses (as a bitmask, impulse 1 most significant), 2q-1 where q is the
+//probability that the XOR of those impulses of the plaintext's delta is a dot
+//The model must have N of at least 2: the bias comes from which letters follow which
+func deltaBiases(model *NgramModel) [32]float64 {
+	var deltaProbs [32]float64
+	for index, logProb := range model.marginalLogProbs()[2] {
+		deltaProbs[(index>>5)^(index&31)] += math.Exp(logProb)
+	}
+
+	var biases [32]float64
+	for set := range biases {
+		for delta, prob := range deltaProbs {
+			if bitParity(delta&set) == 0 {
+				biases[set] += prob
+			} else {
+				biases[set] -= prob
+			}
+		}
+	}
+	return biases
+}
+
+//bitParity returns the XOR of the bits of c
+func bitParity(c int) int {
+	parity := 0
+	for ; c != 0; c >>= 1 {
+		parity ^= c & 1
+	}
+	return parity
+}
+
+//chiTerm is a set of impulses whose de-chi'd deltas are XORed together and counted, and the weight of its count
+type chiTerm struct {
+	impulses []int
+	weight   float64
+}
+
+//chiTermsScore combines the counts of several terms into a single score, in standard deviations
+//deChi[k] is impulse k of the de-chi'd delta stream, for the settings being scored
+func chiTermsScore(terms []chiTerm, deChi [][]int, length int) float64 {
+	total, variance := 0.0, 0.0
+	for _, term := range terms {
+		agreements := 0
+		for i := 0; i < length; i++ {
+			bit := 0
+			for _, k := range term.impulses {
+				bit ^= deChi[k][i]
+			}
+			if bit == 0 {
+				agreements++
+			}
+		}
+		total += term.weight * (float64(agreements) - float64(length)/2)
+		variance += term.weight * term.weight * float64(length) / 4
+	}
+	if variance == 0 {
+		return 0
+	}
+	return total / math.Sqrt(variance)
+}
+
+//setChiWheels sets every chi wheel, storing their starting positions in key and returning their scores
+//The pair of wheels whose impulses' deltas are most biased is set first, then each other wheel in turn,
+//from the most biased impulse to the least
+func setChiWheels(cipherInts []int, chi []*Wheel, biases [32]float64, key []int) [5]float64 {
+	deltas := deltaStream(cipherInts)
+	bias := func(impulses ...int) float64 {
+		set := 0
+		for _, k := range impulses {
+			set |= 1 << uint(4-k)
+		}
+		return biases[set]
+	}
+
+	first, second := 0, 1
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			if math.Abs(bias(a, b)) > math.Abs(bias(first, second)) {
+				first, second = a, b
+			}
+		}
+	}
+
+	var sigmas [5]float64
+	deChi := make([][]int, 5)
+	candidatesA := deChiDeltas(deltas, chi[first], first)
+	candidatesB := deChiDeltas(deltas, chi[second], second)
+	terms := []chiTerm{{[]int{first}, bias(first)}, {[]int{second}, bias(second)}, {[]int{first, second}, bias(first, second)}}
+	best := math.Inf(-1)
+	for sa, bitsA := range candidatesA {
+		for sb, bitsB := range candidatesB {
+			deChi[first], deChi[second] = bitsA, bitsB
+			if score := chiTermsScore(terms, deChi, len(deltas)); score > best {
+				best = score
+				key[first], key[second] = sa, sb
+			}
+		}
+	}
+	deChi[first], deChi[second] = candidatesA[key[first]], candidatesB[key[second]]
+	sigmas[first], sigmas[second] = best, best
+	set := []int{first, second}
+
+	remaining := []int{}
+	for k := 0; k < 5; k++ {
+		if k != first && k != second {
+			remaining = append(remaining, k)
+		}
+	}
+	sort.SliceStable(remaining, func(i, j int) bool { return math.Abs(bias(remaining[i])) > math.Abs(bias(remaining[j])) })
+
+	for _, k := range remaining {
+		terms := []chiTerm{{[]int{k}, bias(k)}}
+		for _, j := range set {
+			terms = append(terms, chiTerm{[]int{j, k}, bias(j, k)})
+		}
+
+		candidates := deChiDeltas(deltas, chi[k], k)
+		best := math.Inf(-1)
+		for s, bits := range candidates {
+			deChi[k] = bits
+			if score := chiTermsScore(terms, deChi, len(deltas)); score > best {
+				best = score
+				key[k] = s
+			}
+		}
+		deChi[k] = candidates[key[k]]
+		sigmas[k] = best
+		set = append(set, k)
+	}
+	return sigmas
+}
+
+//psiSteps returns how far the psi wheels have turned at each character of a message, given the starting
+//positions of the motor wheels and of chi wheel 2 (which the SZ42A limitation reads)
+func (l *Lorenz) psiSteps(m61, m37, chi2 int, length int) []int {
+	steps := make([]int, length)
+	turned := 0
+	for i := range steps {
+		steps[i] = turned
+
+		totalMotor := wheelBit(l.Motor[1], m37)
+		if l.Limitation.Chi2 {
+			limitation := 0
+			if i > 0 {
+				limitation = wheelBit(l.Chi[1], chi2+i-1)
+			}
+			if totalMotor == 1 || limitation == 0 {
+				totalMotor = 1
+			}
+		}
+
+		turned += totalMotor
+		m37 += wheelBit(l.Motor[0], m61)
+		m61++
+	}
+	return steps
+}
+
+//setPsi finds the setting of psi wheel k that makes impulse k of the de-chi'd ciphertext look most like
+//plaintext, given how far the psi wheels had turned at each character
+//It counts the dots and crosses seen at each spoke, so each setting is scored without going back over the message
+func setPsi(deChi, steps []int, w *Wheel, k int, logProbs [2]float64) (int, float64) {
+	counts := make([][2]float64, w.MaxSize)
+	for i, c := range deChi {
+		counts[steps[i]%w.MaxSize][impulse(c, k)]++
+	}
+
+	best, bestScore := 0, math.Inf(-1)
+	for s := 0; s < w.MaxSize; s++ {
+		score := 0.0
+		for spoke, count := range counts {
+			bit := wheelBit(w, s+spoke)
+			score += count[bit]*logProbs[0] + count[1-bit]*logProbs[1]
+		}
+		if score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best, bestScore
+}
+
+//impulseLogProbs returns, for each impulse, the log probability that a plaintext character has a dot or a cross there
+func impulseLogProbs(model *NgramModel) [5][2]float64 {
+	unigrams := model.marginalLogProbs()[1]
+	var probs [5][2]float64
+	for c, logProb := range unigrams {
+		for k := range probs {
+			probs[k][impulse(c, k)] += math.Exp(logProb)
+		}
+	}
+
+	var logProbs [5][2]float64
+	for k := range probs {
+		total := probs[k][0] + probs[k][1]
+		logProbs[k] = [2]float64{math.Log(probs[k][0] / total), math.Log(probs[k][1] / total)}
+	}
+	return logProbs
+}
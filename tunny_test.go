@@ -0,0 +1,133 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_SetLorenz(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	text := strings.Replace(string(bts), "\r", "", -1)
+	plaintext := text[:8000]
+
+	//Train on the rest of the play, so the model has never seen the message
+	model, err := TrainNgramModel(strings.NewReader(text[8000:]), 2)
+	if err != nil {
+		t.Fatalf("Error training model: %s", err.Error())
+	}
+
+	key := MessageKey{7, 30, 2, 11, 22, 42, 5, 50, 17, 33, 60, 9}
+	for _, limitation := range []Limitation{SZ40, SZ42A} {
+		chi, psi, motor := lorenzTestWheels(4)
+		l, err := NewLorenz(chi, psi, motor, limitation)
+		if err != nil {
+			t.Fatalf("Error creating Lorenz: %s", err.Error())
+		}
+		if err := l.SetMessageKey(key); err != nil {
+			t.Fatalf("Error setting key: %s", err.Error())
+		}
+		ciphertext, err := l.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+
+		//In English, impulses 2 and 4 of the plaintext's delta are strongly biased
+		scores, err := RunChiPair(ciphertext, l, 1, 3, 1)
+		if err != nil {
+			t.Fatalf("Error running chi wheels 2 and 4: %s", err.Error())
+		}
+		if scores[0].Setting[0] != key[1] || scores[0].Setting[1] != key[3] {
+			t.Errorf("Chi wheels 2 and 4 set to %v, expected [%d %d]", scores[0].Setting, key[1], key[3])
+		}
+
+		setting, err := SetLorenz(ciphertext, l, model)
+		if err != nil {
+			t.Fatalf("Error setting wheels: %s", err.Error())
+		}
+		for i := range key {
+			if setting.Key[i] != key[i] {
+				t.Errorf("Wheel %d set to %d, expected %d with limitation %+v", i, setting.Key[i], key[i], limitation)
+			}
+		}
+
+		if err := l.SetMessageKey(setting.Key); err != nil {
+			t.Fatalf("Error setting key: %s", err.Error())
+		}
+		if decrypted, err := l.Decrypt(ciphertext); err != nil || decrypted != plaintext {
+			t.Errorf("Recovered setting did not decrypt the message")
+		}
+	}
+}
+
+func Test_RunChi12(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	plaintext := strings.Replace(string(bts), "\r", "", -1)
+
+	key := MessageKey{19, 8, 2, 11, 22, 42, 5, 50, 17, 33, 60, 9}
+	chi, psi, motor := lorenzTestWheels(4)
+	l, err := NewLorenz(chi, psi, motor, SZ40)
+	if err != nil {
+		t.Fatalf("Error creating Lorenz: %s", err.Error())
+	}
+	if err := l.SetMessageKey(key); err != nil {
+		t.Fatalf("Error setting key: %s", err.Error())
+	}
+	ciphertext, err := l.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	scores, err := RunChi12(ciphertext, l, 3)
+	if err != nil {
+		t.Fatalf("Error running chi wheels 1 and 2: %s", err.Error())
+	}
+	if len(scores) != 3 {
+		t.Fatalf("Expected the top 3 settings, got %d", len(scores))
+	}
+	if scores[0].Setting[0] != key[0] || scores[0].Setting[1] != key[1] {
+		t.Errorf("Chi wheels 1 and 2 set to %v, expected [%d %d]", scores[0].Setting, key[0], key[1])
+	}
+	for i := 1; i < len(scores); i++ {
+		if scores[i].Sigma > scores[i-1].Sigma {
+			t.Errorf("Settings are not ranked by score")
+		}
+	}
+}
+
+func Test_SetLorenzErrors(t *testing.T) {
+
+	chi, psi, motor := lorenzTestWheels(5)
+	l, err := NewLorenz(chi, psi, motor, SZ42B)
+	if err != nil {
+		t.Fatalf("Error creating Lorenz: %s", err.Error())
+	}
+	ciphertext, err := l.Encrypt("UMUM4VEVE35KING4HENRY4IV35")
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+
+	unigrams, _ := TrainNgramModel(strings.NewReader("KING4HENRY4IV"), 1)
+	bigrams, _ := TrainNgramModel(strings.NewReader("KING4HENRY4IV"), 2)
+	if _, err := SetLorenz(ciphertext, l, bigrams); err == nil {
+		t.Errorf("Expected an error setting the motor wheels with the SZ42B limitation")
+	}
+	l.Limitation = SZ40
+	if _, err := SetLorenz(ciphertext, l, unigrams); err == nil {
+		t.Errorf("Expected an error setting the chi wheels without bigrams")
+	}
+	if _, err := SetLorenz(ciphertext, l, nil); err == nil {
+		t.Errorf("Expected an error setting the wheels without a model")
+	}
+	if _, err := RunChiPair(ciphertext, l, 2, 2, 1); err == nil {
+		t.Errorf("Expected an error running a chi wheel against itself")
+	}
+}
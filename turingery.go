@@ -0,0 +1,346 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"math"
+)
+
+//PSI_STANDSTILL is the proportion of characters after which the psi wheels are assumed to stand still
+//when re-reading a Lorenz depth with the chi wheels known
+var PSI_STANDSTILL = 0.5
+
+//LorenzPatterns holds the chi and psi wheel patterns recovered from a Lorenz keystream
+//Each wheel starts at the spoke that enciphered the first character of the keystream
+//Complementing a chi wheel and the psi wheel for the same impulse gives the same keystream, so each
+//chi wheel is reported with a dot on its first spoke, and its psi wheel to match
+type LorenzPatterns struct {
+	Chi []*Wheel
+	Psi []*Wheel
+}
+
+//ReadLorenzDepth recovers the plaintext of two or more Lorenz messages that were enciphered from the same
+//wheel start, and the keystream they share, by guessing plaintext: at each position there are only 32 possible
+//keystream characters, and model picks the one that makes every message read best
+//Line breaks are dropped, as they do not turn the wheels
+//The messages are written in alphabet, as the reading is; if it is nil, BLETCHLEY_ALPHABET is used
+//Like ReadDepth, the reading is only a rough first pass
+func ReadLorenzDepth(messages []string, model *NgramModel, alphabet *Alphabet) (*DepthReading, error) {
+	alphabet = alphabet.orDefault()
+	cipherInts, err := lorenzDepthInts(messages, model, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return readDepth(cipherInts, model, alphabet, func(position int) []depthCandidate {
+		return lorenzDepthCandidates(cipherInts, position)
+	}, nil)
+}
+
+//BreakLorenzDepth recovers the chi and psi wheel patterns from two or more Lorenz messages in depth, without
+//knowing any of their plaintext, as was done with the depth sent on 30 August 1941
+//The depth is read by ReadLorenzDepth, and the chi patterns found from that keystream by Turingery (see Turingery),
+//which tolerates a fair number of misread characters. With the chi known, the depth is read again: the keystream
+//with the chi removed is the psi stream, which repeats its last character whenever the psi wheels stand still,
+//so the second reading is far better. The psi patterns are then found from the second reading
+//It also returns the second reading. The psi patterns need every character to be right, so if they cannot be found,
+//it returns the chi patterns alone with the error; correct the reading by hand and pass its keystream to Turingery
+//The messages are written in alphabet, as the reading is; if it is nil, BLETCHLEY_ALPHABET is used
+func BreakLorenzDepth(messages []string, model *NgramModel, alphabet *Alphabet) (*LorenzPatterns, *DepthReading, error) {
+	alphabet = alphabet.orDefault()
+	cipherInts, err := lorenzDepthInts(messages, model, alphabet)
+	if err != nil {
+		return nil, nil, err
+	}
+	candidatesAt := func(position int) []depthCandidate {
+		return lorenzDepthCandidates(cipherInts, position)
+	}
+
+	reading, err := readDepth(cipherInts, model, alphabet, candidatesAt, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	chi, err := turingChi(keystreamXOR(reading.Keystream))
+	if err != nil {
+		return nil, reading, err
+	}
+
+	chiStream := chiStream(chi, len(reading.Keystream))
+	still, moved := math.Log(PSI_STANDSTILL), math.Log((1-PSI_STANDSTILL)/31)
+	reading, err = readDepth(cipherInts, model, alphabet, candidatesAt, func(position int, previous, next depthCandidate) float64 {
+		if previous.key.XOR^chiStream[position-1] == next.key.XOR^chiStream[position] {
+			return still
+		}
+		return moved
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	psi, err := psiFromStutters(keystreamXOR(reading.Keystream), chi)
+	if err != nil {
+		return &LorenzPatterns{Chi: chi}, reading, err
+	}
+	return &LorenzPatterns{Chi: chi, Psi: psi}, reading, nil
+}
+
+//Turingery recovers the chi and psi wheel patterns from a Lorenz keystream (each character with chi wheel 1 and
+//psi wheel 1 XORed into the most significant bit), using Turing's method
+//The delta of the keystream (the XOR of adjacent characters) is the delta of the chi wheels XORed with the delta
+//of the psi stream, which is a dot whenever the psi wheels stand still. So on each impulse the delta of the
+//keystream agrees with the delta of the chi wheel more often than not, and each spoke of the chi delta is found
+//by a vote over every time the wheel came round. Each wheel has the size that CHI_SIZES gives for its position
+//With the chi removed, what is left is the psi stream. The psi wheels turn whenever it changes, and usually stand
+//still when it repeats; where two bits seen on the same spoke of a psi wheel (of the size PSI_SIZES gives for
+//its position) disagree, the psi wheels must have turned on to a character the same as the last, so such a move
+//is put in where it makes the stream consistent
+//The chi patterns tolerate some errors in the keystream, but the psi patterns need it to be exact
+//Unlike the Geheimschreiber's, the Lorenz wheels cannot be swapped between positions: each position has its own
+//size, as NewLorenz requires, so there is no inventory of sizes to narrow down, and the exclusion that
+//removePossibleWheelState does for Crack would have nothing to exclude; searching every size could only give
+//a wheel a size that its position never has
+//It returns an InsufficientTrafficError if the keystream is too short to find a wheel, and an
+//InconsistentBitError if no psi patterns are consistent with it; wheels are numbered as in Lorenz.Wheels
+func Turingery(keystream []int) (*LorenzPatterns, error) {
+	chi, err := turingChi(keystream)
+	if err != nil {
+		return nil, err
+	}
+	psi, err := psiFromStutters(keystream, chi)
+	if err != nil {
+		return nil, err
+	}
+	return &LorenzPatterns{Chi: chi, Psi: psi}, nil
+}
+
+//lorenzDepthInts converts each message in a depth, written in the given alphabet, to integers, dropping line breaks
+func lorenzDepthInts(messages []string, model *NgramModel, alphabet *Alphabet) ([][]int, error) {
+	if model == nil {
+		return nil, errors.New("error: a language model is required to read a depth")
+	}
+	if len(messages) < 2 {
+		return nil, errors.New("error: a depth needs at least two messages")
+	}
+	cipherInts := make([][]int, len(messages))
+	for i, message := range messages {
+		ints, err := lorenzCiphertext(message, alphabet)
+		if err != nil {
+			return nil, err
+		}
+		cipherInts[i] = ints
+	}
+	return cipherInts, nil
+}
+
+//lorenzDepthCandidates returns the 32 ways of reading the messages at the given position, one for each keystream character
+func lorenzDepthCandidates(cipherInts [][]int, position int) []depthCandidate {
+	candidates := make([]depthCandidate, 32)
+	for key := range candidates {
+		plainInts := make([]int, len(cipherInts))
+		for m := range cipherInts {
+			plainInts[m] = cipherInts[m][position] ^ key
+		}
+		candidates[key] = depthCandidate{plainInts: plainInts, key: KeystreamCharacter{XOR: key}}
+	}
+	return candidates
+}
+
+//keystreamXOR returns the XOR part of each keystream character
+func keystreamXOR(keystream []KeystreamCharacter) []int {
+	ints := make([]int, len(keystream))
+	for i, k := range keystream {
+		ints[i] = k.XOR
+	}
+	return ints
+}
+
+//chiStream returns the characters read from the chi wheels, starting from their first spokes
+func chiStream(chi []*Wheel, length int) []int {
+	stream := make([]int, length)
+	start := make([]int, len(chi))
+	for i := range stream {
+		stream[i] = wheelCharacterAt(chi, start, i)
+	}
+	return stream
+}
+
+//chiVotes counts, for each spoke of a chi wheel of the given size on impulse k, how many more times the keystream's
+//delta was a cross than a dot when the wheel was on that spoke
+func chiVotes(deltas []int, k, size int) []int {
+	votes := make([]int, size)
+	for i, d := range deltas {
+		if impulse(d, k) == 1 {
+			votes[i%size]++
+		} else {
+			votes[i%size]--
+		}
+	}
+	return votes
+}
+
+//turingChi finds the chi wheel patterns from a keystream, as described for Turingery
+func turingChi(keystream []int) ([]*Wheel, error) {
+	deltas := deltaStream(keystream)
+	chi := make([]*Wheel, len(CHI_SIZES))
+	for k, size := range CHI_SIZES {
+		if len(deltas) < size {
+			return nil, &InsufficientTrafficError{Wheel: k, Spoke: -1}
+		}
+		chi[k] = chiFromVotes(chiVotes(deltas, k, size))
+	}
+	return chi, nil
+}
+
+//chiFromVotes builds a chi wheel from the votes for its delta, with a dot on its first spoke
+//The delta of a wheel has an even number of crosses, so if the votes give an odd number, the closest vote is overturned
+func chiFromVotes(votes []int) *Wheel {
+	delta := make([]int, len(votes))
+	crosses, closest := 0, 0
+	for s, v := range votes {
+		if v > 0 {
+			delta[s] = 1
+			crosses++
+		}
+		if math.Abs(float64(v)) < math.Abs(float64(votes[closest])) {
+			closest = s
+		}
+	}
+	if crosses%2 == 1 {
+		delta[closest] ^= 1
+	}
+
+	items := make([]int, len(votes))
+	for s := 1; s < len(items); s++ {
+		items[s] = items[s-1] ^ delta[s-1]
+	}
+	return NewWheel(items)
+}
+
+//psiTables records the bits seen on each spoke of each psi wheel
+type psiTables struct {
+	//spokes[k] holds the bit seen on each spoke of psi wheel k, or -1 if none has been seen
+	spokes [][]int
+}
+
+func newPsiTables() *psiTables {
+	t := &psiTables{spokes: make([][]int, len(PSI_SIZES))}
+	for k, size := range PSI_SIZES {
+		t.spokes[k] = make([]int, size)
+		for s := range t.spokes[k] {
+			t.spokes[k][s] = -1
+		}
+	}
+	return t
+}
+
+func (t *psiTables) copy() *psiTables {
+	c := &psiTables{spokes: make([][]int, len(t.spokes))}
+	for k := range t.spokes {
+		c.spokes[k] = append([]int{}, t.spokes[k]...)
+	}
+	return c
+}
+
+//record notes the psi character seen when the psi wheels had turned the given number of steps
+//It returns false if some psi wheel has already shown a different bit on that spoke
+func (t *psiTables) record(step, psi int) bool {
+	consistent := true
+	for k := range t.spokes {
+		bit := impulse(psi, k)
+		spoke := step % len(t.spokes[k])
+		if t.spokes[k][spoke] == -1 {
+			t.spokes[k][spoke] = bit
+		} else if t.spokes[k][spoke] != bit {
+			consistent = false
+		}
+	}
+	return consistent
+}
+
+//psiReplay follows the psi stream from character start to character end (exclusive), starting from the given tables
+//and number of steps, assuming that the psi wheels turned whenever the stream changed and stood still otherwise,
+//except that they also turned at the characters in moves
+//It returns the number of steps the wheels had turned at each character it followed, and the first character
+//that was inconsistent with the tables, or end if there was none
+func psiReplay(stream []int, tables *psiTables, step, start, end int, moves map[int]bool) ([]int, int) {
+	steps := []int{}
+	for i := start; i < end; i++ {
+		if i > 0 && (stream[i] != stream[i-1] || moves[i]) {
+			step++
+		}
+		steps = append(steps, step)
+		if !tables.record(step, stream[i]) {
+			return steps, i
+		}
+	}
+	return steps, end
+}
+
+//psiFromStutters finds the psi wheel patterns from a keystream, given the chi wheel patterns, as described for Turingery
+//Where the stream is inconsistent, it tries a move at every repeated character within a turn of the largest wheel
+//before the inconsistency, makes the one that keeps the stream consistent for longest, and starts again
+func psiFromStutters(keystream []int, chi []*Wheel) ([]*Wheel, error) {
+	chiChars := chiStream(chi, len(keystream))
+	stream := make([]int, len(keystream))
+	for i, k := range keystream {
+		stream[i] = k ^ chiChars[i]
+	}
+
+	maxSize := 0
+	for _, size := range PSI_SIZES {
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+
+	moves := map[int]bool{}
+	var tables *psiTables
+	for {
+		tables = newPsiTables()
+		steps, conflict := psiReplay(stream, tables, 0, 0, len(stream), moves)
+		if conflict == len(stream) {
+			break
+		}
+
+		windowStart := conflict
+		for windowStart > 1 && steps[windowStart-1] >= steps[conflict]-maxSize-1 {
+			windowStart--
+		}
+		base := newPsiTables()
+		baseSteps, _ := psiReplay(stream, base, 0, 0, windowStart, moves)
+		baseStep := 0
+		if len(baseSteps) > 0 {
+			baseStep = baseSteps[len(baseSteps)-1]
+		}
+		horizon := conflict + 4*maxSize
+		if horizon > len(stream) {
+			horizon = len(stream)
+		}
+
+		bestReach, bestMove := conflict, -1
+		for i := windowStart; i <= conflict; i++ {
+			if i == 0 || stream[i] != stream[i-1] || moves[i] {
+				continue
+			}
+			moves[i] = true
+			_, reach := psiReplay(stream, base.copy(), baseStep, windowStart, horizon, moves)
+			delete(moves, i)
+			if reach > bestReach {
+				bestReach, bestMove = reach, i
+			}
+		}
+		if bestMove < 0 {
+			return nil, &InconsistentBitError{Wheel: -1, Position: conflict}
+		}
+		moves[bestMove] = true
+	}
+
+	psi := make([]*Wheel, len(tables.spokes))
+	for k, items := range tables.spokes {
+		for s, bit := range items {
+			if bit == -1 {
+				return nil, &InsufficientTrafficError{Wheel: 5 + k, Spoke: s}
+			}
+		}
+		psi[k] = NewWheel(append([]int{}, items...))
+	}
+	return psi, nil
+}
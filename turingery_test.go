@@ -0,0 +1,178 @@
+package geheimschreiber
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+//lorenzTestDepth enciphers two stretches of the test plaintext from the same wheel start, returning the messages,
+//the keystream, and the patterns that Turingery should find (each wheel turned to the start, with chi 1 a dot)
+func lorenzTestDepth(t *testing.T, length int) ([]string, []int, *LorenzPatterns) {
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	text := strings.Replace(strings.Replace(string(bts), "\r", "", -1), "\n", "", -1)
+	plaintexts := []string{text[:length], text[len(text)-length:]}
+
+	chi, psi, motor := lorenzTestWheels(6)
+	l, err := NewLorenz(chi, psi, motor, SZ40)
+	if err != nil {
+		t.Fatalf("Error creating Lorenz: %s", err.Error())
+	}
+	key := MessageKey{3, 12, 20, 1, 9, 40, 2, 33, 7, 58, 14, 30}
+
+	messages := make([]string, len(plaintexts))
+	for m, plaintext := range plaintexts {
+		l.SetMessageKey(key)
+		messages[m], err = l.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+	}
+
+	keystream := make([]int, length)
+	for i := range keystream {
+		p, _ := BLETCHLEY_ALPHABET.Code(rune(plaintexts[0][i]))
+		c, _ := BLETCHLEY_ALPHABET.Code(rune(messages[0][i]))
+		keystream[i] = p ^ c
+	}
+
+	expected := &LorenzPatterns{}
+	for k := 0; k < 5; k++ {
+		c, p := rotateWheel(chi[k], key[k]), rotateWheel(psi[k], key[5+k])
+		if c.Items[0] == 1 {
+			c, p = complementWheel(c), complementWheel(p)
+		}
+		expected.Chi = append(expected.Chi, c)
+		expected.Psi = append(expected.Psi, p)
+	}
+	return messages, keystream, expected
+}
+
+func rotateWheel(w *Wheel, start int) *Wheel {
+	items := make([]int, w.MaxSize)
+	for s := range items {
+		items[s] = w.Items[(start+s)%w.MaxSize]
+	}
+	return NewWheel(items)
+}
+
+func complementWheel(w *Wheel) *Wheel {
+	items := make([]int, w.MaxSize)
+	for s := range items {
+		items[s] = 1 - w.Items[s]
+	}
+	return NewWheel(items)
+}
+
+func checkLorenzPatterns(t *testing.T, patterns, expected *LorenzPatterns) {
+	for k := 0; k < 5; k++ {
+		if !patterns.Chi[k].Equals(*expected.Chi[k]) {
+			t.Errorf("Chi wheel %d does not match expected result", k+1)
+		}
+		if !patterns.Psi[k].Equals(*expected.Psi[k]) {
+			t.Errorf("Psi wheel %d does not match expected result", k+1)
+		}
+	}
+}
+
+func Test_Turingery(t *testing.T) {
+
+	_, keystream, expected := lorenzTestDepth(t, 5000)
+	patterns, err := Turingery(keystream)
+	if err != nil {
+		t.Fatalf("Error breaking keystream: %s", err.Error())
+	}
+	checkLorenzPatterns(t, patterns, expected)
+	_, _, motor := lorenzTestWheels(6)
+	if _, err := NewLorenz(patterns.Chi, patterns.Psi, motor, SZ40); err != nil {
+		t.Errorf("Error creating Lorenz from the patterns: %s", err.Error())
+	}
+
+	//Even from too little keystream to read them right, each chi wheel has the size of its position
+	chi, err := turingChi(keystream[:300])
+	if err != nil {
+		t.Fatalf("Error finding chi wheels: %s", err.Error())
+	}
+	for k, w := range chi {
+		if w.MaxSize != CHI_SIZES[k] {
+			t.Errorf("Chi wheel %d has %d spokes, expected %d", k+1, w.MaxSize, CHI_SIZES[k])
+		}
+	}
+
+	if _, err := Turingery(keystream[:30]); err == nil {
+		t.Errorf("Expected an error breaking a short keystream")
+	}
+}
+
+func Test_BreakLorenzDepth(t *testing.T) {
+
+	bts, err := ioutil.ReadFile(TEST_PLAINTEXT_FILE)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err.Error())
+	}
+	//The depth is made from the start and end of the play, so train on the middle
+	text := strings.Replace(strings.Replace(string(bts), "\r", "", -1), "\n", "", -1)
+	model, err := TrainNgramModel(strings.NewReader(text[5000:len(text)-5000]), 3)
+	if err != nil {
+		t.Fatalf("Error training model: %s", err.Error())
+	}
+
+	messages, keystream, expected := lorenzTestDepth(t, 5000)
+	first, err := ReadLorenzDepth(messages, model, nil)
+	if err != nil {
+		t.Fatalf("Error reading depth: %s", err.Error())
+	}
+
+	//The psi patterns need an exact reading, which the model does not usually manage on its own
+	patterns, reading, err := BreakLorenzDepth(messages, model, nil)
+	if patterns == nil || reading == nil {
+		t.Fatalf("Error breaking depth: %s", err.Error())
+	}
+	if err == nil {
+		checkLorenzPatterns(t, patterns, expected)
+	}
+	for k := 0; k < 5; k++ {
+		if !patterns.Chi[k].Equals(*expected.Chi[k]) {
+			t.Errorf("Chi wheel %d does not match expected result", k+1)
+		}
+	}
+
+	//Knowing the chi makes the second reading far better than the first
+	correct, reread := 0, 0
+	for i, k := range keystream {
+		if first.Keystream[i].XOR == k {
+			correct++
+		}
+		if reading.Keystream[i].XOR == k {
+			reread++
+		}
+	}
+	if reread < len(keystream)*9/10 || reread <= correct {
+		t.Errorf("Read %d of %d keystream characters correctly after finding the chi, and %d before", reread, len(keystream), correct)
+	}
+
+	//Messages in another notation are read the same way, and the reading is written in it
+	ita2Messages := make([]string, len(messages))
+	for i, message := range messages {
+		ita2Messages[i], _ = BLETCHLEY_ALPHABET.Translate(message, ITA2_ALPHABET)
+	}
+	ita2Reading, err := ReadLorenzDepth(ita2Messages, model, ITA2_ALPHABET)
+	if err != nil {
+		t.Fatalf("Error reading depth in ITA2: %s", err.Error())
+	}
+	for m, plaintext := range first.Plaintexts {
+		if expected, _ := BLETCHLEY_ALPHABET.Translate(plaintext, ITA2_ALPHABET); ita2Reading.Plaintexts[m] != expected {
+			t.Errorf("Message %d reads differently in ITA2", m)
+		}
+	}
+
+	if _, err := ReadLorenzDepth(messages[:1], model, nil); err == nil {
+		t.Errorf("Expected an error reading a single message")
+	}
+	if _, _, err := BreakLorenzDepth(messages, nil, nil); err == nil {
+		t.Errorf("Expected an error breaking a depth without a model")
+	}
+}
@@ -0,0 +1,158 @@
+package geheimschreiber
+
+import (
+	"fmt"
+	"sort"
+)
+
+//Variant describes a model of the Siemens & Halske T52 Geheimschreiber
+type Variant struct {
+	Name string
+
+	//WheelSizes are the sizes of the machine's ten wheels; they may be fitted in any order
+	WheelSizes []int
+
+	//Network is the permutation network controlled by the last five controls
+	Network PermutationNetwork
+
+	//Controls gives, for each of the ten controls (the five XOR bits, then the five swaps of Network),
+	//the positions of the wheels whose bits are XORed together to drive it
+	//If nil, each control is driven by a single wheel: control i by the wheel in position i
+	Controls [][]int
+
+	//Stepper decides how far each wheel turns after each character
+	//If nil, every wheel turns once per character
+	Stepper Stepper
+}
+
+//T52C_CONTROLS drives each control from the XOR of four wheels, as on the T52c, d and e
+//These are representative combinations; on those models the combinations were set by the
+//machine's wiring, so substitute the ones for the machine that sent the traffic if they are known
+var T52C_CONTROLS = [][]int{
+	{0, 1, 4, 6},
+	{1, 2, 5, 7},
+	{2, 3, 6, 8},
+	{3, 4, 7, 9},
+	{0, 4, 5, 8},
+	{1, 5, 6, 9},
+	{0, 2, 6, 7},
+	{1, 3, 7, 8},
+	{2, 4, 8, 9},
+	{0, 3, 5, 9},
+}
+
+//T52AB is the T52a and T52b, on which each wheel drives a single control
+var T52AB = &Variant{Name: "T52a/b", WheelSizes: WHEEL_SIZES, Network: DEFAULT_NETWORK}
+
+//T52C is the T52c, on which each control is driven by a combination of wheels
+var T52C = &Variant{Name: "T52c", WheelSizes: WHEEL_SIZES, Network: DEFAULT_NETWORK, Controls: T52C_CONTROLS}
+
+//T52D is the T52d, which combines wheels like the T52c, and turns them irregularly
+var T52D = &Variant{Name: "T52d", WheelSizes: WHEEL_SIZES, Network: DEFAULT_NETWORK, Controls: T52C_CONTROLS, Stepper: T52D_STEPPER}
+
+//T52E is the T52e, which combines wheels like the T52c, and turns them irregularly like the T52d
+var T52E = &Variant{Name: "T52e", WheelSizes: WHEEL_SIZES, Network: DEFAULT_NETWORK, Controls: T52C_CONTROLS, Stepper: T52D_STEPPER}
+
+//VARIANTS holds the preset variants, by name
+var VARIANTS = map[string]*Variant{
+	"T52a/b": T52AB,
+	"T52a":   T52AB,
+	"T52b":   T52AB,
+	"T52c":   T52C,
+	"T52d":   T52D,
+	"T52e":   T52E,
+}
+
+//VariantByName returns the preset variant with the given name, such as "T52c"
+func VariantByName(name string) (*Variant, error) {
+	v, ok := VARIANTS[name]
+	if !ok {
+		return nil, fmt.Errorf("error: unknown variant %q", name)
+	}
+	return v, nil
+}
+
+//Validate checks that the variant has ten wheels, a valid permutation network, that
+//every control is driven by at least one wheel, and by no wheel more than once,
+//and that its stepper (if it is a PinControlledStepper) cannot jam
+func (v *Variant) Validate() error {
+	if len(v.WheelSizes) != 10 {
+		return fmt.Errorf("error: variant %s has %d wheels, expected 10", v.Name, len(v.WheelSizes))
+	}
+	if err := v.Network.Validate(); err != nil {
+		return err
+	}
+	if err := validateStepper(v.Stepper); err != nil {
+		return err
+	}
+	if v.Controls == nil {
+		return nil
+	}
+	return validateControls(v.Controls)
+}
+
+//validateControls checks that there are ten controls, each driven by a set of wheels in positions 0-9
+func validateControls(controls [][]int) error {
+	if len(controls) != 10 {
+		return fmt.Errorf("error: %d controls, expected 10", len(controls))
+	}
+	for i, wheels := range controls {
+		if len(wheels) == 0 {
+			return fmt.Errorf("error: control %d is not driven by any wheel", i)
+		}
+		seen := map[int]bool{}
+		for _, w := range wheels {
+			if w < 0 || w >= 10 {
+				return fmt.Errorf("error: control %d is driven by wheel %d, which does not exist", i, w)
+			}
+			if seen[w] {
+				return fmt.Errorf("error: control %d is driven by wheel %d twice", i, w)
+			}
+			seen[w] = true
+		}
+	}
+	return nil
+}
+
+//NewVariantMachine creates a Machine of the given variant from ten wheels, in the order they sit on the machine
+//It returns an InvalidWheelError if the wheels are not valid, or their sizes are not those of the variant
+func NewVariantMachine(v *Variant, wheels []*Wheel) (*Machine, error) {
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+	m, err := NewMachineWithNetwork(wheels, v.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]int, len(wheels))
+	for i, w := range wheels {
+		sizes[i] = w.MaxSize
+	}
+	sort.Ints(sizes)
+	expected := append([]int{}, v.WheelSizes...)
+	sort.Ints(expected)
+	for i := range sizes {
+		if sizes[i] != expected[i] {
+			return nil, &InvalidWheelError{Wheel: -1, Reason: fmt.Sprintf("wheel sizes %v do not match the %s", sizes, v.Name)}
+		}
+	}
+
+	m.Controls = v.Controls
+	m.Stepper = v.Stepper
+	return m, nil
+}
+
+//controlBits combines the bits read from the wheels into the ten controls
+func controlBits(controls [][]int, wheelBits [10]int) [10]int {
+	if controls == nil {
+		return wheelBits
+	}
+	var bits [10]int
+	for i, wheels := range controls {
+		for _, w := range wheels {
+			bits[i] ^= wheelBits[w]
+		}
+	}
+	return bits
+}
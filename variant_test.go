@@ -0,0 +1,105 @@
+package geheimschreiber
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_VariantMachines(t *testing.T) {
+
+	plaintext := "UMUM4VEVE35KING4HENRY4IV35"
+
+	//The T52a/b is the machine that sent the test traffic
+	ab, err := NewVariantMachine(T52AB, TEST_CIPHERTEXT_SOLVED_WHEELS)
+	if err != nil {
+		t.Fatalf("Error creating T52a/b: %s", err.Error())
+	}
+	ab.Reset()
+	abCiphertext, err := ab.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err.Error())
+	}
+	ResetWheels(TEST_CIPHERTEXT_SOLVED_WHEELS)
+	expected, _ := EncryptString(TEST_CIPHERTEXT_SOLVED_WHEELS, plaintext)
+	if abCiphertext != expected {
+		t.Errorf("T52a/b encrypted to %q, expected %q", abCiphertext, expected)
+	}
+
+	for _, name := range []string{"T52c", "T52d", "T52e"} {
+		v, err := VariantByName(name)
+		if err != nil {
+			t.Fatalf("Error finding variant: %s", err.Error())
+		}
+		m, err := NewVariantMachine(v, TEST_CIPHERTEXT_SOLVED_WHEELS)
+		if err != nil {
+			t.Fatalf("Error creating %s: %s", name, err.Error())
+		}
+
+		m.Reset()
+		ciphertext, err := m.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		if ciphertext == abCiphertext {
+			t.Errorf("%s encrypted the same way as the T52a/b", name)
+		}
+
+		m.Reset()
+		decrypted, err := m.Decrypt(ciphertext)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("%s did not survive a round trip: %q", name, decrypted)
+		}
+	}
+	ResetWheels(TEST_CIPHERTEXT_SOLVED_WHEELS)
+
+	if _, err := VariantByName("T52f"); err == nil {
+		t.Errorf("Expected an error for an unknown variant")
+	}
+}
+
+func Test_ControlBits(t *testing.T) {
+
+	//Only wheel 4 has a 1, so exactly the controls that it drives are set
+	var wheelBits [10]int
+	wheelBits[4] = 1
+	bits := controlBits(T52C_CONTROLS, wheelBits)
+	for i, wheels := range T52C_CONTROLS {
+		expected := 0
+		for _, w := range wheels {
+			if w == 4 {
+				expected = 1
+			}
+		}
+		if bits[i] != expected {
+			t.Errorf("Control %d is %d, expected %d", i, bits[i], expected)
+		}
+	}
+
+	if controlBits(nil, wheelBits) != wheelBits {
+		t.Errorf("Expected each wheel to drive its own control without combinations")
+	}
+}
+
+func Test_VariantErrors(t *testing.T) {
+
+	//A T52 cannot take wheels of the wrong sizes
+	small := []*Wheel{}
+	for i := 0; i < 10; i++ {
+		small = append(small, NewWheel([]int{0, 1}))
+	}
+	_, err := NewVariantMachine(T52C, small)
+	var wheelErr *InvalidWheelError
+	if !errors.As(err, &wheelErr) {
+		t.Errorf("Expected an invalid wheel error, got %v", err)
+	}
+
+	bad := *T52C
+	bad.Controls = append([][]int{{0, 0}}, T52C_CONTROLS[1:]...)
+	if err := bad.Validate(); err == nil {
+		t.Errorf("Expected a control driven twice by the same wheel to be invalid")
+	}
+	bad.Controls = append([][]int{{10}}, T52C_CONTROLS[1:]...)
+	if err := bad.Validate(); err == nil {
+		t.Errorf("Expected a control driven by a missing wheel to be invalid")
+	}
+}